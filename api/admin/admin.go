@@ -0,0 +1,59 @@
+package adminAPI
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	baselogger "github.com/capdale/was/logger"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var logger = baselogger.Logger
+
+type AdminAPI struct {
+	Auth *auth.Auth
+}
+
+func New(auth *auth.Auth) *AdminAPI {
+	return &AdminAPI{
+		Auth: auth,
+	}
+}
+
+type setUserRoleUri struct {
+	Username string `uri:"username" binding:"required"`
+}
+
+type setUserRoleForm struct {
+	Role string `json:"role" binding:"required,oneof=user moderator admin"`
+}
+
+func (a *AdminAPI) SetUserRoleHandler(ctx *gin.Context) {
+	uri := &setUserRoleUri{}
+	if err := ctx.BindUri(uri); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "bind uri", err)
+		return
+	}
+	form := &setUserRoleForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	if err := a.Auth.SetUserRole(uri.Username, form.Role); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "user not found"})
+			logger.ErrorWithCTX(ctx, "set user role", err)
+			return
+		}
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "set user role", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
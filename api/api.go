@@ -3,6 +3,7 @@ package api
 import (
 	"net/http"
 
+	"github.com/capdale/was/types/binaryuuid"
 	"github.com/capdale/was/types/claimer"
 	"github.com/gin-gonic/gin"
 )
@@ -21,6 +22,11 @@ func MustGetClaimer(ctx *gin.Context) *claimer.Claimer {
 	return claimer
 }
 
+func MustGetSession(ctx *gin.Context) *binaryuuid.UUID {
+	session := ctx.MustGet("session").(*binaryuuid.UUID)
+	return session
+}
+
 func BasicInternalServerError(ctx *gin.Context) {
 	ctx.JSON(http.StatusInternalServerError, gin.H{"message": "internal server error"})
 }
@@ -32,3 +38,14 @@ func BasicUnAuthorizedError(ctx *gin.Context) {
 func BasicBadRequestError(ctx *gin.Context) {
 	ctx.JSON(http.StatusBadRequest, gin.H{"message": "bad request"})
 }
+
+// page granting access to account must not be framed by other site (clickjacking)
+func DenyFraming(ctx *gin.Context) {
+	ctx.Header("X-Frame-Options", "DENY")
+	ctx.Header("Content-Security-Policy", "frame-ancestors 'none'")
+}
+
+// error response of oauth2 endpoints, RFC 6749 section 5.2
+func OAuthError(ctx *gin.Context, status int, code string) {
+	ctx.JSON(status, gin.H{"error": code})
+}
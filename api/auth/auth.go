@@ -7,6 +7,7 @@ import (
 	"github.com/capdale/was/api"
 	"github.com/capdale/was/auth"
 	baselogger "github.com/capdale/was/logger"
+	"github.com/capdale/was/model"
 	"github.com/capdale/was/types/claimer"
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +16,11 @@ var logger = baselogger.Logger
 
 type database interface {
 	DeleteUserAccount(claimer *claimer.Claimer) error
+	GetPersonalAccessTokens(claimer *claimer.Claimer) (*[]*model.PersonalAccessTokenAPI, error)
+	DeletePersonalAccessToken(claimer *claimer.Claimer, tokenId uint64) error
+	GetUserProfile(claimer *claimer.Claimer) (*model.UserProfileAPI, error)
+	UpdateUserProfile(claimer *claimer.Claimer, username *string, isPrivate *bool) error
+	IsUsernameUsed(username string) (bool, error)
 }
 
 type AuthAPI struct {
@@ -41,12 +47,59 @@ func New(database database, auth *auth.Auth) *AuthAPI {
 	}
 }
 
-func (a *AuthAPI) SetBlacklistHandler(ctx *gin.Context) {
-	accessToken := ctx.Param("access_token")
-	refreshToken := ctx.Param("refresh_token")
-	if err := a.Auth.BlackToken(&accessToken, &refreshToken); err != nil {
-		ctx.Status(http.StatusBadRequest)
-		logger.ErrorWithCTX(ctx, "black token", err)
+type logoutForm struct {
+	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+}
+
+func (a *AuthAPI) LogoutHandler(ctx *gin.Context) {
+	accessToken, err := auth.TokenFromRequest(ctx.Request)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "no token"})
+		logger.ErrorWithCTX(ctx, "no access token", err)
+		return
+	}
+	if err := auth.VerifyCSRF(ctx.Request); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "invalid csrf token"})
+		logger.ErrorWithCTX(ctx, "verify csrf", err)
+		return
+	}
+
+	refreshToken, err := auth.RefreshTokenFromRequest(ctx.Request)
+	if err != nil {
+		form := &logoutForm{}
+		if err := ctx.ShouldBind(form); err != nil || form.RefreshToken == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "no refresh token"})
+			logger.ErrorWithCTX(ctx, "no refresh token", err)
+			return
+		}
+		refreshToken = form.RefreshToken
+	}
+
+	if err := a.Auth.Logout(accessToken, refreshToken); err != nil {
+		if errors.Is(err, auth.ErrTokenInvalid) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid token"})
+			logger.ErrorWithCTX(ctx, "logout", err)
+			return
+		}
+		if errors.Is(err, auth.ErrNotTokenPair) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid token pair"})
+			logger.ErrorWithCTX(ctx, "logout", err)
+			return
+		}
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "logout", err)
+		return
+	}
+	a.Auth.ClearTokenCookies(ctx)
+	ctx.Status(http.StatusOK)
+}
+
+// log out everywhere, every token issued before is invalid
+func (a *AuthAPI) LogoutAllHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	if err := a.Auth.RevokeAllTokens(claimer); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "revoke all tokens", err)
 		return
 	}
 	ctx.Status(http.StatusOK)
@@ -66,28 +119,103 @@ type RefreshTokenReq struct {
 	RefreshToken *string `json:"refresh_token" binding:"required"`
 }
 
+// refresh token is X-Refresh-Token header, cookie or body
 func (a *AuthAPI) RefreshTokenHandler(ctx *gin.Context) {
-	form := new(RefreshTokenReq)
-	err := ctx.BindJSON(form)
+	refreshToken, err := auth.RefreshTokenFromRequest(ctx.Request)
 	if err != nil {
-		api.BasicBadRequestError(ctx)
-		logger.ErrorWithCTX(ctx, "binding form", err)
+		form := new(RefreshTokenReq)
+		if err := ctx.BindJSON(form); err != nil {
+			api.BasicBadRequestError(ctx)
+			logger.ErrorWithCTX(ctx, "binding form", err)
+			return
+		}
+		refreshToken = *form.RefreshToken
+	}
+	if err := auth.VerifyCSRF(ctx.Request); err != nil {
+		ctx.JSON(http.StatusForbidden, gin.H{"message": "invalid csrf token"})
+		logger.ErrorWithCTX(ctx, "verify csrf", err)
 		return
 	}
 
 	userAgent := ctx.Request.UserAgent()
 
-	newToken, newRefreshToken, err := a.Auth.RefreshToken(*form.RefreshToken, &userAgent)
-	if err != nil {
+	newToken, newRefreshToken, err := a.Auth.RefreshToken(refreshToken, &userAgent, ctx.ClientIP())
+	if errors.Is(err, auth.ErrRefreshTokenReused) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "refresh token reused, session revoked"})
+		logger.ErrorWithCTX(ctx, "refresh token reused", err)
+		return
+	} else if errors.Is(err, auth.ErrImpossibleTravel) {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "login required"})
+		logger.ErrorWithCTX(ctx, "impossible travel", err)
+		return
+	} else if err != nil {
 		api.BasicUnAuthorizedError(ctx)
 		logger.ErrorWithCTX(ctx, "refresh token failed", err)
 		return
 	}
-	ctx.JSON(http.StatusOK, gin.H{
-		"access_token":  newToken,
-		"refresh_token": newRefreshToken,
-	})
+	a.Auth.RespondToken(ctx, gin.H{}, newToken, newRefreshToken)
+}
+
+func (a *AuthAPI) JWKSHandler(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, a.Auth.JWKS())
 }
 
 func (a *AuthAPI) WhoAmIHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	profile, err := a.DB.GetUserProfile(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get user profile", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, profile)
+}
+
+type updateMeForm struct {
+	Username  *string `json:"username" binding:"omitempty,min=6,max=20,alphanum"`
+	IsPrivate *bool   `json:"is_private"`
+}
+
+func (a *AuthAPI) UpdateMeHandler(ctx *gin.Context) {
+	form := &updateMeForm{}
+	if err := ctx.ShouldBindJSON(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	if form.Username != nil {
+		current, err := a.DB.GetUserProfile(claimer)
+		if err != nil {
+			api.BasicInternalServerError(ctx)
+			logger.ErrorWithCTX(ctx, "get user profile", err)
+			return
+		}
+		if *form.Username == current.Username {
+			// unchanged username is not conflict, nothing to update
+			form.Username = nil
+		} else if used, err := a.DB.IsUsernameUsed(*form.Username); err != nil {
+			api.BasicInternalServerError(ctx)
+			logger.ErrorWithCTX(ctx, "is username used", err)
+			return
+		} else if used {
+			ctx.JSON(http.StatusConflict, gin.H{"message": "username already used"})
+			return
+		}
+	}
+
+	if err := a.DB.UpdateUserProfile(claimer, form.Username, form.IsPrivate); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "update user profile", err)
+		return
+	}
+
+	profile, err := a.DB.GetUserProfile(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get user profile", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, profile)
 }
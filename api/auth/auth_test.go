@@ -0,0 +1,83 @@
+package authapi_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authapi "github.com/capdale/was/api/auth"
+	"github.com/capdale/was/logger"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// current user has username, otheruser is used by other user
+type fakeDB struct {
+	username string
+}
+
+func (f *fakeDB) DeleteUserAccount(claimer *claimer.Claimer) error {
+	return nil
+}
+
+func (f *fakeDB) GetPersonalAccessTokens(claimer *claimer.Claimer) (*[]*model.PersonalAccessTokenAPI, error) {
+	return &[]*model.PersonalAccessTokenAPI{}, nil
+}
+
+func (f *fakeDB) DeletePersonalAccessToken(claimer *claimer.Claimer, tokenId uint64) error {
+	return nil
+}
+
+func (f *fakeDB) GetUserProfile(claimer *claimer.Claimer) (*model.UserProfileAPI, error) {
+	return &model.UserProfileAPI{Username: f.username}, nil
+}
+
+func (f *fakeDB) UpdateUserProfile(claimer *claimer.Claimer, username *string, isPrivate *bool) error {
+	if username != nil {
+		f.username = *username
+	}
+	return nil
+}
+
+func (f *fakeDB) IsUsernameUsed(username string) (bool, error) {
+	return username == f.username || username == "otheruser", nil
+}
+
+func TestUpdateMeUsername(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(zap.NewNop())
+
+	uuid, _ := binaryuuid.NewRandom()
+	claimer := claimer.New(&uuid)
+	a := &authapi.AuthAPI{DB: &fakeDB{username: "testuser"}}
+	r := gin.New()
+	r.PATCH("/me", func(ctx *gin.Context) {
+		ctx.Set("claimer", claimer)
+	}, a.UpdateMeHandler)
+
+	var cases = []struct {
+		name string
+		body string
+		want int
+	}{
+		{"unchanged username", `{"username":"testuser","is_private":true}`, http.StatusOK},
+		{"username of other user", `{"username":"otheruser"}`, http.StatusConflict},
+		{"new username", `{"username":"newuser"}`, http.StatusOK},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/me", bytes.NewBufferString(tcase.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tcase.want {
+				t.Errorf("got %d, expected %d", w.Code, tcase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package deviceAPI
+
+// device authorization grant, RFC 8628
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/config"
+	baseLogger "github.com/capdale/was/logger"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+)
+
+var logger = baseLogger.Logger
+
+var ErrUserCodeCollision = errors.New("user code collided too many times")
+
+const (
+	DeviceCodeGrantType  = "urn:ietf:params:oauth:grant-type:device_code"
+	deviceCodeExpiration = time.Minute * 10
+	pollInterval         = time.Second * 5
+	userCodeCharset      = "BCDFGHJKLMNPQRSTVWXZ" // no vowels, not to make word
+	userCodeLength       = 8
+	userCodeMaxRetries   = 3
+
+	// wrong user codes approved by user, user code is short enough to guess
+	approveThreshold  = 5
+	approveWindow     = time.Minute * 15
+	approveLockout    = time.Minute
+	approveMaxLockout = time.Hour
+)
+
+type state interface {
+	SetDeviceAuthorization(deviceCode string, userCode string, data []byte, expired time.Duration) (bool, error)
+	GetDeviceAuthorization(userCode string) ([]byte, error)
+	UpdateDeviceAuthorization(userCode string, previous []byte, data []byte) (bool, error)
+	GetDeviceUserCode(deviceCode string) (string, error)
+	PopDeviceAuthorization(deviceCode string, userCode string) error
+	IsDevicePollTooFast(deviceCode string, interval time.Duration) (bool, error)
+	GetLockout(key string) (time.Duration, error)
+	FailAttempt(key string, threshold int64, window time.Duration, lockout time.Duration, maxLockout time.Duration) (int64, time.Duration, error)
+}
+
+type DeviceAPI struct {
+	Auth            *auth.Auth
+	State           state
+	Clients         map[string]string // client id to name
+	VerificationURI string
+}
+
+func New(auth *auth.Auth, state state, devices []*config.Device, verificationURI string) *DeviceAPI {
+	clients := make(map[string]string, len(devices))
+	for _, device := range devices {
+		clients[device.Id] = device.Name
+	}
+	return &DeviceAPI{
+		Auth:            auth,
+		State:           state,
+		Clients:         clients,
+		VerificationURI: verificationURI,
+	}
+}
+
+type deviceAuthorization struct {
+	ClientId string `json:"client_id"`
+	Claimer  string `json:"claimer"` // set when user approved
+	Denied   bool   `json:"denied"`
+}
+
+func (a *deviceAuthorization) isDecided() bool {
+	return a.Claimer != "" || a.Denied
+}
+
+func generateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeCharset)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// user may type code in lower case, with or without hyphen
+func normalizeUserCode(userCode string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToUpper(userCode))
+}
+
+func formatUserCode(userCode string) string {
+	if len(userCode) != userCodeLength {
+		return userCode
+	}
+	return userCode[:userCodeLength/2] + "-" + userCode[userCodeLength/2:]
+}
+
+// authorization with stored data, data is compared when authorization is updated
+func (d *DeviceAPI) getAuthorization(userCode string) (*deviceAuthorization, []byte, error) {
+	data, err := d.State.GetDeviceAuthorization(userCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	authorization := &deviceAuthorization{}
+	if err := json.Unmarshal(data, authorization); err != nil {
+		return nil, nil, err
+	}
+	return authorization, data, nil
+}
+
+type deviceCodeForm struct {
+	ClientId string `form:"client_id" json:"client_id" binding:"required"`
+}
+
+func (d *DeviceAPI) DeviceCodeHandler(ctx *gin.Context) {
+	form := &deviceCodeForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.OAuthError(ctx, http.StatusBadRequest, "invalid_request")
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+	if _, ok := d.Clients[form.ClientId]; !ok {
+		api.OAuthError(ctx, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	rand32, err := auth.RandToken(32)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "generate random token", err)
+		return
+	}
+	deviceCode := base64.RawURLEncoding.EncodeToString(*rand32)
+	data, err := json.Marshal(&deviceAuthorization{ClientId: form.ClientId})
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "marshal device authorization", err)
+		return
+	}
+
+	// user code is short, retry on collision with pending one
+	var userCode string
+	retries := 0
+	for set := false; !set; {
+		if retries++; retries > userCodeMaxRetries {
+			api.BasicInternalServerError(ctx)
+			logger.ErrorWithCTX(ctx, "set device authorization", ErrUserCodeCollision)
+			return
+		}
+		if userCode, err = generateUserCode(); err != nil {
+			api.BasicInternalServerError(ctx)
+			logger.ErrorWithCTX(ctx, "generate user code", err)
+			return
+		}
+		if set, err = d.State.SetDeviceAuthorization(deviceCode, userCode, data, deviceCodeExpiration); err != nil {
+			api.BasicInternalServerError(ctx)
+			logger.ErrorWithCTX(ctx, "set device authorization", err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"device_code":               deviceCode,
+		"user_code":                 formatUserCode(userCode),
+		"verification_uri":          d.VerificationURI,
+		"verification_uri_complete": d.VerificationURI + "?" + url.Values{"user_code": {formatUserCode(userCode)}}.Encode(),
+		"expires_in":                int(deviceCodeExpiration.Seconds()),
+		"interval":                  int(pollInterval.Seconds()),
+	})
+}
+
+type deviceTokenForm struct {
+	GrantType  string `form:"grant_type" json:"grant_type" binding:"required"`
+	DeviceCode string `form:"device_code" json:"device_code" binding:"required"`
+	ClientId   string `form:"client_id" json:"client_id" binding:"required"`
+}
+
+// polled by device until user approve or deny
+func (d *DeviceAPI) DeviceTokenHandler(ctx *gin.Context) {
+	form := &deviceTokenForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.OAuthError(ctx, http.StatusBadRequest, "invalid_request")
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+	if form.GrantType != DeviceCodeGrantType {
+		api.OAuthError(ctx, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	userCode, err := d.State.GetDeviceUserCode(form.DeviceCode)
+	if err != nil {
+		api.OAuthError(ctx, http.StatusBadRequest, "expired_token")
+		logger.ErrorWithCTX(ctx, "get device user code", err)
+		return
+	}
+	authorization, _, err := d.getAuthorization(userCode)
+	if err != nil {
+		api.OAuthError(ctx, http.StatusBadRequest, "expired_token")
+		logger.ErrorWithCTX(ctx, "get device authorization", err)
+		return
+	}
+	if authorization.ClientId != form.ClientId {
+		api.OAuthError(ctx, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	if !authorization.isDecided() {
+		tooFast, err := d.State.IsDevicePollTooFast(form.DeviceCode, pollInterval)
+		if err != nil {
+			api.BasicInternalServerError(ctx)
+			logger.ErrorWithCTX(ctx, "check device poll", err)
+			return
+		}
+		if tooFast {
+			api.OAuthError(ctx, http.StatusBadRequest, "slow_down")
+			return
+		}
+		api.OAuthError(ctx, http.StatusBadRequest, "authorization_pending")
+		return
+	}
+
+	// device code is single use whether approved or denied
+	if err := d.State.PopDeviceAuthorization(form.DeviceCode, userCode); err != nil {
+		api.OAuthError(ctx, http.StatusBadRequest, "expired_token")
+		logger.ErrorWithCTX(ctx, "pop device authorization", err)
+		return
+	}
+	if authorization.Denied {
+		api.OAuthError(ctx, http.StatusBadRequest, "access_denied")
+		return
+	}
+
+	claimer, err := claimer.Parse(authorization.Claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "parse claimer", err)
+		return
+	}
+	userAgent := ctx.Request.UserAgent()
+	tokenString, refreshToken, err := d.Auth.IssueToken(claimer, &userAgent, ctx.ClientIP())
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue token", err)
+		return
+	}
+	d.Auth.RespondToken(ctx, gin.H{"token_type": "Bearer"}, tokenString, refreshToken)
+}
+
+type approveDeviceForm struct {
+	UserCode string `json:"user_code" binding:"required,max=16"`
+	Approve  bool   `json:"approve"`
+}
+
+func approveThrottleKey(claimer string) string {
+	return fmt.Sprintf("device_approve:%s", claimer)
+}
+
+func abortTooManyRequests(ctx *gin.Context, lockout time.Duration) {
+	ctx.Header("Retry-After", fmt.Sprint(int64(math.Ceil(lockout.Seconds()))))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"message": "too many requests"})
+}
+
+// response 429 with Retry-After if user approved too many wrong user codes
+func (d *DeviceAPI) isApproveLockedOut(ctx *gin.Context, claimer string) bool {
+	lockout, err := d.State.GetLockout(approveThrottleKey(claimer))
+	if err != nil {
+		// fail open, user code still expires in minutes
+		logger.ErrorWithCTX(ctx, "get lockout", err)
+		return false
+	}
+	if lockout <= 0 {
+		return false
+	}
+	abortTooManyRequests(ctx, lockout)
+	return true
+}
+
+// response 404, or 429 if this attempt started lockout
+func (d *DeviceAPI) failApprove(ctx *gin.Context, claimer string) {
+	_, lockout, err := d.State.FailAttempt(approveThrottleKey(claimer), approveThreshold, approveWindow, approveLockout, approveMaxLockout)
+	if err != nil {
+		logger.ErrorWithCTX(ctx, "fail attempt", err)
+	}
+	if lockout > 0 {
+		abortTooManyRequests(ctx, lockout)
+		return
+	}
+	ctx.JSON(http.StatusNotFound, gin.H{"message": "invalid user code"})
+}
+
+// logged in user approve or deny device, device get tokens of user on next poll
+func (d *DeviceAPI) ApproveDeviceHandler(ctx *gin.Context) {
+	form := &approveDeviceForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx).String()
+	if d.isApproveLockedOut(ctx, claimer) {
+		return
+	}
+
+	userCode := normalizeUserCode(form.UserCode)
+	authorization, previous, err := d.getAuthorization(userCode)
+	if err != nil {
+		d.failApprove(ctx, claimer)
+		logger.ErrorWithCTX(ctx, "get device authorization", err)
+		return
+	}
+	if authorization.isDecided() {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "already decided"})
+		return
+	}
+
+	if form.Approve {
+		authorization.Claimer = claimer
+	} else {
+		authorization.Denied = true
+	}
+	data, err := json.Marshal(authorization)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "marshal device authorization", err)
+		return
+	}
+	updated, err := d.State.UpdateDeviceAuthorization(userCode, previous, data)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "update device authorization", err)
+		return
+	}
+	if !updated {
+		// other request decided between get and update
+		ctx.JSON(http.StatusConflict, gin.H{"message": "already decided"})
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+type deviceViewQuery struct {
+	UserCode string `form:"user_code" binding:"max=16"`
+}
+
+// verification page, user code is filled if opened by verification_uri_complete
+func (d *DeviceAPI) DeviceView(ctx *gin.Context) {
+	api.DenyFraming(ctx)
+	// approval is submitted with session cookie
+	if !d.Auth.IsCookieEnabled() {
+		ctx.HTML(http.StatusNotImplemented, "device.tmpl", gin.H{"error": "sign in on web is not enabled on this server"})
+		return
+	}
+
+	query := &deviceViewQuery{}
+	if err := ctx.ShouldBindQuery(query); err != nil {
+		// TODO: change to 404 page
+		ctx.Status(http.StatusNotFound)
+		logger.ErrorWithCTX(ctx, "bind query", err)
+		return
+	}
+
+	clientName := ""
+	if query.UserCode != "" {
+		if authorization, _, err := d.getAuthorization(normalizeUserCode(query.UserCode)); err == nil {
+			clientName = d.Clients[authorization.ClientId]
+		}
+	}
+
+	ctx.HTML(http.StatusOK, "device.tmpl", gin.H{
+		"endpoint": "/auth/device/approve",
+		"userCode": query.UserCode,
+		"client":   clientName,
+	})
+}
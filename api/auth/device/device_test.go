@@ -0,0 +1,192 @@
+package deviceAPI_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	deviceAPI "github.com/capdale/was/api/auth/device"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/config"
+	"github.com/capdale/was/logger"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// in memory state, expiration is ignored
+type memState struct {
+	mu           sync.Mutex
+	data         map[string][]byte
+	attempts     map[string]int64
+	beforeUpdate func() // run before compare, to race with other request
+}
+
+func newMemState() *memState {
+	return &memState{data: map[string][]byte{}, attempts: map[string]int64{}}
+}
+
+func (m *memState) SetDeviceAuthorization(deviceCode string, userCode string, data []byte, expired time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data[userCode]; ok {
+		return false, nil
+	}
+	m.data[userCode] = data
+	return true, nil
+}
+
+func (m *memState) GetDeviceAuthorization(userCode string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[userCode]
+	if !ok {
+		return nil, errors.New("no authorization")
+	}
+	return data, nil
+}
+
+func (m *memState) UpdateDeviceAuthorization(userCode string, previous []byte, data []byte) (bool, error) {
+	if m.beforeUpdate != nil {
+		m.beforeUpdate()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !bytes.Equal(m.data[userCode], previous) {
+		return false, nil
+	}
+	m.data[userCode] = data
+	return true, nil
+}
+
+func (m *memState) GetDeviceUserCode(deviceCode string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (m *memState) PopDeviceAuthorization(deviceCode string, userCode string) error {
+	return errors.New("not implemented")
+}
+
+func (m *memState) IsDevicePollTooFast(deviceCode string, interval time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (m *memState) GetLockout(key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.attempts[key] >= 5 {
+		return time.Minute, nil
+	}
+	return 0, nil
+}
+
+func (m *memState) FailAttempt(key string, threshold int64, window time.Duration, lockout time.Duration, maxLockout time.Duration) (int64, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts[key]++
+	if m.attempts[key] < threshold {
+		return m.attempts[key], 0, nil
+	}
+	return m.attempts[key], lockout, nil
+}
+
+const userCode = "BCDFGHJK"
+
+func newRouter(t *testing.T, state *memState) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger.Init(zap.NewNop())
+
+	data, _ := json.Marshal(map[string]string{"client_id": "cli"})
+	if _, err := state.SetDeviceAuthorization("device code", userCode, data, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	uuid, _ := binaryuuid.NewRandom()
+	claimer := claimer.New(&uuid)
+	d := deviceAPI.New(nil, state, []*config.Device{{Id: "cli", Name: "CLI"}}, "https://test/auth/device")
+	r := gin.New()
+	r.POST("/approve", func(ctx *gin.Context) {
+		ctx.Set("claimer", claimer)
+	}, d.ApproveDeviceHandler)
+	return r
+}
+
+func approve(r *gin.Engine, userCode string) int {
+	body, _ := json.Marshal(map[string]interface{}{"user_code": userCode, "approve": true})
+	req := httptest.NewRequest(http.MethodPost, "/approve", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestApproveDevice(t *testing.T) {
+	r := newRouter(t, newMemState())
+	if status := approve(r, "bcdf-ghjk"); status != http.StatusAccepted {
+		t.Fatalf("got %d, expected %d", status, http.StatusAccepted)
+	}
+	if status := approve(r, userCode); status != http.StatusConflict {
+		t.Errorf("got %d, expected %d", status, http.StatusConflict)
+	}
+}
+
+func TestApproveDeviceRace(t *testing.T) {
+	state := newMemState()
+	r := newRouter(t, state)
+
+	// other request denied between get and update
+	state.beforeUpdate = func() {
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		state.data[userCode], _ = json.Marshal(map[string]interface{}{"client_id": "cli", "denied": true})
+	}
+	if status := approve(r, userCode); status != http.StatusConflict {
+		t.Errorf("got %d, expected %d", status, http.StatusConflict)
+	}
+}
+
+func TestApproveDeviceThrottle(t *testing.T) {
+	r := newRouter(t, newMemState())
+	for i := 1; i < 5; i++ {
+		if status := approve(r, "XXXXXXXX"); status != http.StatusNotFound {
+			t.Fatalf("attempt %d: got %d, expected %d", i, status, http.StatusNotFound)
+		}
+	}
+	if status := approve(r, "XXXXXXXX"); status != http.StatusTooManyRequests {
+		t.Errorf("got %d, expected %d", status, http.StatusTooManyRequests)
+	}
+	// even right code is locked out
+	if status := approve(r, userCode); status != http.StatusTooManyRequests {
+		t.Errorf("got %d, expected %d", status, http.StatusTooManyRequests)
+	}
+}
+
+func TestDeviceViewWithoutCookieMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a, err := auth.New(nil, nil, &config.Key{
+		Jwtkey:     "jwtkey of test, longer than 32 bytes",
+		RefreshKey: "refreshKey of test, longer than 32 bytes",
+		Issuer:     "https://test",
+		Audience:   "https://test",
+	}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.LoadHTMLFiles("../../../templates/auth/device.tmpl")
+	r.GET("/device", deviceAPI.New(a, newMemState(), nil, "https://test/auth/device").DeviceView)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/device", nil))
+	if w.Code != http.StatusNotImplemented {
+		t.Errorf("got %d, expected %d", w.Code, http.StatusNotImplemented)
+	}
+	if w.Header().Get("Content-Security-Policy") != "frame-ancestors 'none'" {
+		t.Errorf("framing is not denied")
+	}
+}
@@ -9,6 +9,7 @@ import (
 )
 
 type userInfo struct {
+	Id    int64  `json:"id"`
 	Login string `json:"login"`
 }
 
@@ -18,19 +19,19 @@ type emailInfo struct {
 	Verified bool
 }
 
-func (g *GithubAuth) getUserId(ctx context.Context, t *oauth2.Token) (string, error) {
+func (g *GithubAuth) getUserInfo(ctx context.Context, t *oauth2.Token) (*userInfo, error) {
 	client := g.OAuthConfig.Client(ctx, t)
 	body, err := authapi.GetBody(client, userInfoEndpoint)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	info := &userInfo{}
 	err = json.Unmarshal(body, info)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return info.Login, nil
+	return info, nil
 }
 
 func (g *GithubAuth) getEmail(ctx context.Context, t *oauth2.Token) (string, error) {
@@ -0,0 +1,151 @@
+package identityAPI
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+)
+
+const loginCodeExpiration = time.Minute
+
+// app redirect of login, app receive one-time code instead of token
+type AppRedirect struct {
+	ClientId      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	CodeChallenge string `json:"code_challenge"` // S256 challenge of app, verified on exchange
+	State         string `json:"state"`          // state of app, returned as is
+}
+
+func (i *IdentityAPI) IsAllowedRedirect(clientId string, redirectURI string) bool {
+	redirects, ok := i.Apps[clientId]
+	return ok && slices.Contains(redirects, redirectURI)
+}
+
+func redirectToApp(ctx *gin.Context, redirect *AppRedirect, values url.Values) {
+	u, err := url.Parse(redirect.RedirectURI)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "parse redirect uri", err)
+		return
+	}
+	query := u.Query()
+	for key, value := range values {
+		query[key] = value
+	}
+	if redirect.State != "" {
+		query.Set("state", redirect.State)
+	}
+	u.RawQuery = query.Encode()
+	ctx.Redirect(http.StatusFound, u.String())
+}
+
+type loginCode struct {
+	Claimer       string `json:"claimer"`
+	Username      string `json:"username"`
+	ClientId      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	CodeChallenge string `json:"code_challenge"`
+}
+
+func (i *IdentityAPI) redirectLoginCode(ctx *gin.Context, user *model.User, redirect *AppRedirect) {
+	rand32, err := auth.RandToken(32)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "generate random token", err)
+		return
+	}
+	code := base64.RawURLEncoding.EncodeToString(*rand32)
+	data, err := json.Marshal(&loginCode{
+		Claimer:       claimer.New(&user.AuthUUID).String(),
+		Username:      user.Username,
+		ClientId:      redirect.ClientId,
+		RedirectURI:   redirect.RedirectURI,
+		CodeChallenge: redirect.CodeChallenge,
+	})
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "marshal login code", err)
+		return
+	}
+	if err := i.State.SetLoginCode(code, data, loginCodeExpiration); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "set login code", err)
+		return
+	}
+	redirectToApp(ctx, redirect, url.Values{"code": {code}})
+}
+
+type exchangeCodeForm struct {
+	Code         string `json:"code" form:"code" binding:"required"`
+	CodeVerifier string `json:"code_verifier" form:"code_verifier" binding:"required,min=43,max=128"`
+	ClientId     string `json:"client_id" form:"client_id" binding:"required"`
+	RedirectURI  string `json:"redirect_uri" form:"redirect_uri" binding:"required"`
+}
+
+// exchange one-time code to token, code is single use
+func (i *IdentityAPI) ExchangeCodeHandler(ctx *gin.Context) {
+	form := &exchangeCodeForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	data, err := i.State.PopLoginCode(form.Code)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid code"})
+		logger.ErrorWithCTX(ctx, "pop login code", err)
+		return
+	}
+	code := &loginCode{}
+	if err := json.Unmarshal(data, code); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "unmarshal login code", err)
+		return
+	}
+
+	if code.ClientId != form.ClientId ||
+		code.RedirectURI != form.RedirectURI ||
+		!auth.VerifyCodeChallenge(code.CodeChallenge, form.CodeVerifier) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid code"})
+		return
+	}
+
+	claimer, err := claimer.Parse(code.Claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "parse claimer", err)
+		return
+	}
+
+	// totp may be enabled after code is issued
+	challenge, err := i.mfaChallenge(&claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "mfa challenge", err)
+		return
+	}
+	if challenge != "" {
+		respondMfaChallenge(ctx, challenge)
+		return
+	}
+
+	userAgent := ctx.Request.UserAgent()
+	tokenString, refreshToken, err := i.Auth.IssueToken(claimer, &userAgent, ctx.ClientIP())
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue token", err)
+		return
+	}
+
+	i.Auth.RespondToken(ctx, gin.H{"username": code.Username}, tokenString, refreshToken)
+}
@@ -0,0 +1,368 @@
+package identityAPI
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/config"
+	baseLogger "github.com/capdale/was/logger"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var logger = baseLogger.Logger
+
+const (
+	linkTokenExpiration    = time.Minute * 10
+	mfaChallengeExpiration = time.Minute * 5
+)
+
+// oauth state with this prefix return link token instead of login
+const LinkStatePrefix = "link."
+
+type database interface {
+	GetUserByEmail(email string) (*model.User, error)
+	GetUserByIdentity(accountType int, subject string) (*model.User, error)
+	AttachLegacyIdentity(user *model.User, identity *model.Identity) (bool, error)
+	CreateIdentity(claimer *claimer.Claimer, identity *model.Identity) error
+	GetIdentities(claimer *claimer.Claimer) (*[]*model.IdentityAPI, error)
+	HasPassword(claimer *claimer.Claimer) (bool, error)
+	GetTOTP(claimer *claimer.Claimer) ([]byte, bool, error)
+	DeleteIdentity(claimer *claimer.Claimer, accountType int) error
+	CreateWithIdentity(username string, identity *model.Identity) (*model.User, error)
+	IsUsernameUsed(username string) (bool, error)
+}
+
+type state interface {
+	SetLinkToken(token string, data []byte, expired time.Duration) error
+	PopLinkToken(token string) ([]byte, error)
+	SetLoginCode(code string, data []byte, expired time.Duration) error
+	PopLoginCode(code string) ([]byte, error)
+	SetRegistrationToken(token string, data []byte, expired time.Duration) error
+	GetRegistrationToken(token string) ([]byte, error)
+	DeleteRegistrationToken(token string) error
+	SetMfaChallenge(challenge string, claimer string, expired time.Duration) error
+}
+
+type IdentityAPI struct {
+	DB    database
+	Auth  *auth.Auth
+	State state
+	Apps  map[string][]string // allowed redirect uris of app client
+}
+
+func New(database database, auth *auth.Auth, state state, apps []*config.App) *IdentityAPI {
+	appRedirects := make(map[string][]string, len(apps))
+	for _, app := range apps {
+		appRedirects[app.Id] = app.Redirects
+	}
+	return &IdentityAPI{
+		DB:    database,
+		Auth:  auth,
+		State: state,
+		Apps:  appRedirects,
+	}
+}
+
+type linkIdentity struct {
+	AccountType int    `json:"account_type"`
+	Subject     string `json:"subject"`
+	Email       string `json:"email"`
+}
+
+func (i *IdentityAPI) issueLinkToken(identity *model.Identity) (string, error) {
+	rand32, err := auth.RandToken(32)
+	if err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(*rand32)
+	data, err := json.Marshal(&linkIdentity{
+		AccountType: identity.AccountType,
+		Subject:     identity.Subject,
+		Email:       identity.Email,
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := i.State.SetLinkToken(token, data, linkTokenExpiration); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (i *IdentityAPI) popLinkToken(token string) (*model.Identity, error) {
+	data, err := i.State.PopLinkToken(token)
+	if err != nil {
+		return nil, err
+	}
+	link := &linkIdentity{}
+	if err := json.Unmarshal(data, link); err != nil {
+		return nil, err
+	}
+	return &model.Identity{
+		AccountType: link.AccountType,
+		Subject:     link.Subject,
+		Email:       link.Email,
+	}, nil
+}
+
+// login with verified identity of provider, respond registration token if email is not used,
+// user choose username with it. username is suggestion of provider.
+// if email is used by other user, respond link token, user login that account and link identity.
+// result is delivered by redirect to app if redirect is not nil
+func (i *IdentityAPI) Login(ctx *gin.Context, identity *model.Identity, username string, redirect *AppRedirect) {
+	user, err := i.DB.GetUserByIdentity(identity.AccountType, identity.Subject)
+	if err == gorm.ErrRecordNotFound {
+		user, err = i.DB.GetUserByEmail(identity.Email)
+		if err == gorm.ErrRecordNotFound {
+			i.registrationRequired(ctx, identity, username, redirect)
+			return
+		} else if err != nil {
+			api.BasicInternalServerError(ctx)
+			logger.ErrorWithCTX(ctx, "query user by email", err)
+			return
+		} else {
+			attached, err := i.DB.AttachLegacyIdentity(user, identity)
+			if err != nil {
+				api.BasicInternalServerError(ctx)
+				logger.ErrorWithCTX(ctx, "attach legacy identity", err)
+				return
+			}
+			if !attached {
+				i.linkRequired(ctx, identity, redirect)
+				return
+			}
+		}
+	} else if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "query user by identity", err)
+		return
+	}
+
+	claimer := claimer.New(&user.AuthUUID)
+	challenge, err := i.mfaChallenge(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "mfa challenge", err)
+		return
+	}
+	if challenge != "" {
+		if redirect != nil {
+			redirectToApp(ctx, redirect, url.Values{"mfa_required": {"true"}, "mfa_token": {challenge}})
+			return
+		}
+		respondMfaChallenge(ctx, challenge)
+		return
+	}
+
+	if redirect != nil {
+		i.redirectLoginCode(ctx, user, redirect)
+		return
+	}
+
+	userAgent := ctx.Request.UserAgent()
+	tokenString, refreshToken, err := i.Auth.IssueToken(*claimer, &userAgent, ctx.ClientIP())
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue token", err)
+		return
+	}
+
+	i.Auth.RespondToken(ctx, gin.H{"username": user.Username}, tokenString, refreshToken)
+}
+
+// identity replaces password only, origin account with totp still needs second factor,
+// return challenge completed at /auth/login/mfa or empty if not required
+func (i *IdentityAPI) mfaChallenge(claimer *claimer.Claimer) (string, error) {
+	hasPassword, err := i.DB.HasPassword(claimer)
+	if err != nil || !hasPassword {
+		return "", err
+	}
+	_, totpEnabled, err := i.DB.GetTOTP(claimer)
+	if err != nil || !totpEnabled {
+		return "", err
+	}
+	rand32, err := auth.RandToken(32)
+	if err != nil {
+		return "", err
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(*rand32)
+	if err := i.State.SetMfaChallenge(challenge, claimer.String(), mfaChallengeExpiration); err != nil {
+		return "", err
+	}
+	return challenge, nil
+}
+
+func respondMfaChallenge(ctx *gin.Context, challenge string) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    challenge,
+	})
+}
+
+func (i *IdentityAPI) linkRequired(ctx *gin.Context, identity *model.Identity, redirect *AppRedirect) {
+	token, err := i.issueLinkToken(identity)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue link token", err)
+		return
+	}
+	if redirect != nil {
+		redirectToApp(ctx, redirect, url.Values{
+			"error":        {"link_required"},
+			"link_token":   {token},
+			"account_type": {model.AccountTypeName(identity.AccountType)},
+		})
+		return
+	}
+	ctx.JSON(http.StatusConflict, gin.H{
+		"message":       "email already used",
+		"link_required": true,
+		"link_token":    token,
+		"account_type":  model.AccountTypeName(identity.AccountType),
+	})
+}
+
+// respond link token of verified identity, logged in user link it with LinkIdentityHandler
+func (i *IdentityAPI) Link(ctx *gin.Context, identity *model.Identity, redirect *AppRedirect) {
+	token, err := i.issueLinkToken(identity)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue link token", err)
+		return
+	}
+	if redirect != nil {
+		redirectToApp(ctx, redirect, url.Values{
+			"link_token":   {token},
+			"account_type": {model.AccountTypeName(identity.AccountType)},
+		})
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"link_token":   token,
+		"account_type": model.AccountTypeName(identity.AccountType),
+	})
+}
+
+func (i *IdentityAPI) GetIdentitiesHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	identities, err := i.DB.GetIdentities(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get identities", err)
+		return
+	}
+	hasPassword, err := i.DB.HasPassword(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "has password", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"identities":   identities,
+		"has_password": hasPassword,
+	})
+}
+
+type linkIdentityForm struct {
+	LinkToken string `json:"link_token" form:"link_token" binding:"required"`
+}
+
+func (i *IdentityAPI) LinkIdentityHandler(ctx *gin.Context) {
+	form := &linkIdentityForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	identity, err := i.popLinkToken(form.LinkToken)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid link token"})
+		logger.ErrorWithCTX(ctx, "pop link token", err)
+		return
+	}
+
+	if _, err := i.DB.GetUserByIdentity(identity.AccountType, identity.Subject); err == nil {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "identity already linked"})
+		return
+	} else if err != gorm.ErrRecordNotFound {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "query user by identity", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	identities, err := i.DB.GetIdentities(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get identities", err)
+		return
+	}
+	accountType := model.AccountTypeName(identity.AccountType)
+	for _, linked := range *identities {
+		if linked.AccountType == accountType {
+			ctx.JSON(http.StatusConflict, gin.H{"message": "provider already linked"})
+			return
+		}
+	}
+
+	if err := i.DB.CreateIdentity(claimer, identity); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "create identity", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// unlink social identity, password is removed by origin api
+func (i *IdentityAPI) DeleteIdentityHandler(ctx *gin.Context) {
+	accountType, ok := model.AccountTypeByName(ctx.Param("provider"))
+	if !ok || accountType == model.AccountTypeOrigin {
+		api.BasicBadRequestError(ctx)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	identities, err := i.DB.GetIdentities(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get identities", err)
+		return
+	}
+	hasPassword, err := i.DB.HasPassword(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "has password", err)
+		return
+	}
+
+	linked := false
+	for _, identity := range *identities {
+		if identity.AccountType == ctx.Param("provider") {
+			linked = true
+		}
+	}
+	if !linked {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "identity not found"})
+		return
+	}
+	if !hasPassword && len(*identities) < 2 {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "last login method cannot be removed"})
+		return
+	}
+
+	if err := i.DB.DeleteIdentity(claimer, accountType); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "delete identity", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
@@ -0,0 +1,132 @@
+package identityAPI_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	identityAPI "github.com/capdale/was/api/auth/identity"
+	"github.com/capdale/was/config"
+	"github.com/capdale/was/database"
+	"github.com/capdale/was/logger"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/test"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// in memory state, only mfa challenge is used by login
+type memState struct {
+	challenges map[string]string
+}
+
+func (m *memState) SetLinkToken(token string, data []byte, expired time.Duration) error {
+	return errors.New("not implemented")
+}
+
+func (m *memState) PopLinkToken(token string) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *memState) SetLoginCode(code string, data []byte, expired time.Duration) error {
+	return errors.New("not implemented")
+}
+
+func (m *memState) PopLoginCode(code string) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *memState) SetRegistrationToken(token string, data []byte, expired time.Duration) error {
+	return errors.New("not implemented")
+}
+
+func (m *memState) GetRegistrationToken(token string) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (m *memState) DeleteRegistrationToken(token string) error {
+	return errors.New("not implemented")
+}
+
+func (m *memState) SetMfaChallenge(challenge string, claimer string, expired time.Duration) error {
+	m.challenges[challenge] = claimer
+	return nil
+}
+
+func TestLinkedIdentityLoginRequiresTOTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(zap.NewNop())
+
+	tmpDir := test.NewTmpDir("was_identity")
+	d, err := database.NewSQLite(&config.SQLite{
+		Path: tmpDir.Join("test.db"),
+	}, math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		d.Close()
+		tmpDir.Close()
+	})
+
+	// origin account with totp, github identity linked
+	ticket, _ := d.CreateTicketByEmail("test@test.test")
+	if err := d.CreateOriginViaTicket(ticket, "testuser", "Testtest1234!@"); err != nil {
+		t.Fatal(err)
+	}
+	claimer, _ := d.GetOriginUserClaim("testuser", "Testtest1234!@")
+	if _, err := d.StartTOTP(claimer, []byte("totp secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EnableTOTP(claimer, 1, &[][]byte{[]byte("recovery code")}); err != nil {
+		t.Fatal(err)
+	}
+	identity := &model.Identity{AccountType: model.AccountTypeGithub, Subject: "101", Email: "test@test.test"}
+	if err := d.CreateIdentity(claimer, identity); err != nil {
+		t.Fatal(err)
+	}
+
+	state := &memState{challenges: map[string]string{}}
+	i := identityAPI.New(d, nil, state, nil)
+	r := gin.New()
+	r.GET("/login", func(ctx *gin.Context) {
+		i.Login(ctx, identity, "", nil)
+	})
+	r.GET("/app", func(ctx *gin.Context) {
+		i.Login(ctx, identity, "", &identityAPI.AppRedirect{
+			ClientId:    "app",
+			RedirectURI: "app://callback",
+		})
+	})
+
+	t.Run("json", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+		body := map[string]interface{}{}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusOK || body["mfa_required"] != true || body["access_token"] != nil {
+			t.Fatalf("got %d %v, expected mfa challenge", w.Code, body)
+		}
+		if state.challenges[body["mfa_token"].(string)] != claimer.String() {
+			t.Errorf("challenge is not stored for user")
+		}
+	})
+
+	t.Run("app redirect", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/app", nil))
+		location, err := url.Parse(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := location.Query()
+		if w.Code != http.StatusFound || query.Get("mfa_token") == "" || query.Has("code") {
+			t.Errorf("got %d %s, expected mfa challenge instead of code", w.Code, location)
+		}
+	})
+}
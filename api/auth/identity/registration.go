@@ -0,0 +1,169 @@
+package identityAPI
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const registrationTokenExpiration = time.Minute * 30
+
+// same policy of username binding, min=6,max=20,alphanum
+func isValidUsername(username string) bool {
+	if len(username) < 6 || len(username) > 20 {
+		return false
+	}
+	for _, char := range username {
+		if !('a' <= char && char <= 'z' || 'A' <= char && char <= 'Z' || '0' <= char && char <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// user is not created until username is chosen
+type pendingRegistration struct {
+	Identity      linkIdentity `json:"identity"`
+	CodeChallenge string       `json:"code_challenge,omitempty"` // challenge of app, token is redirected to app
+}
+
+func (i *IdentityAPI) registrationRequired(ctx *gin.Context, identity *model.Identity, username string, redirect *AppRedirect) {
+	rand32, err := auth.RandToken(32)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "generate random token", err)
+		return
+	}
+	token := base64.RawURLEncoding.EncodeToString(*rand32)
+	registration := &pendingRegistration{
+		Identity: linkIdentity{
+			AccountType: identity.AccountType,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+		},
+	}
+	if redirect != nil {
+		registration.CodeChallenge = redirect.CodeChallenge
+	}
+	data, err := json.Marshal(registration)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "marshal registration", err)
+		return
+	}
+	if err := i.State.SetRegistrationToken(token, data, registrationTokenExpiration); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "set registration token", err)
+		return
+	}
+
+	// suggestion is given only if it can be used
+	if !isValidUsername(username) {
+		username = ""
+	} else if used, err := i.DB.IsUsernameUsed(username); err != nil || used {
+		username = ""
+	}
+
+	if redirect != nil {
+		redirectToApp(ctx, redirect, url.Values{
+			"error":              {"registration_required"},
+			"registration_token": {token},
+			"username":           {username},
+		})
+		return
+	}
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"registration_required": true,
+		"registration_token":    token,
+		"username":              username,
+	})
+}
+
+type registerForm struct {
+	RegistrationToken string `json:"registration_token" form:"registration_token" binding:"required"`
+	Username          string `json:"username" form:"username" binding:"required,min=6,max=20,alphanum"`
+	CodeVerifier      string `json:"code_verifier" form:"code_verifier"` // required if token is redirected to app
+}
+
+// choose username of first social login, user is created here
+func (i *IdentityAPI) RegisterHandler(ctx *gin.Context) {
+	form := &registerForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	data, err := i.State.GetRegistrationToken(form.RegistrationToken)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid registration token"})
+		logger.ErrorWithCTX(ctx, "get registration token", err)
+		return
+	}
+	registration := &pendingRegistration{}
+	if err := json.Unmarshal(data, registration); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "unmarshal registration", err)
+		return
+	}
+	if registration.CodeChallenge != "" && !auth.VerifyCodeChallenge(registration.CodeChallenge, form.CodeVerifier) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid registration token"})
+		return
+	}
+
+	used, err := i.DB.IsUsernameUsed(form.Username)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "check username", err)
+		return
+	}
+	if used {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "username already used"})
+		return
+	}
+
+	identity := &model.Identity{
+		AccountType: registration.Identity.AccountType,
+		Subject:     registration.Identity.Subject,
+		Email:       registration.Identity.Email,
+	}
+	// email can be used by other user after token is issued
+	if _, err := i.DB.GetUserByEmail(identity.Email); err == nil {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "email already used"})
+		return
+	} else if err != gorm.ErrRecordNotFound {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "query user by email", err)
+		return
+	}
+
+	user, err := i.DB.CreateWithIdentity(form.Username, identity)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "create social account", err)
+		return
+	}
+	if err := i.State.DeleteRegistrationToken(form.RegistrationToken); err != nil {
+		logger.ErrorWithCTX(ctx, "delete registration token", err)
+	}
+
+	userAgent := ctx.Request.UserAgent()
+	claimer := claimer.New(&user.AuthUUID)
+	tokenString, refreshToken, err := i.Auth.IssueToken(*claimer, &userAgent, ctx.ClientIP())
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue token", err)
+		return
+	}
+
+	i.Auth.RespondToken(ctx, gin.H{"username": user.Username}, tokenString, refreshToken)
+}
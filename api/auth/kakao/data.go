@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 
 	authapi "github.com/capdale/was/api/auth"
+	"github.com/capdale/was/model"
 	"golang.org/x/oauth2"
 )
 
 type userInfo struct {
+	Id      int64        `json:"id"`
 	Account kakaoAccount `json:"kakao_account"`
 }
 
@@ -21,43 +24,47 @@ type kakaoAccount struct {
 	Email           string `json:"email"`
 }
 
-func getUserEmailWithAccessToken(accessToken string) (string, error) {
+func getIdentityWithAccessToken(ctx context.Context, accessToken string) (*model.Identity, error) {
 	client := &http.Client{}
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s?property_keys=[\"kakao_account.email\"]", userInfoEndpoint), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s?property_keys=[\"kakao_account.email\"]", userInfoEndpoint), nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
 	req.Header.Set("Content-type", "application/x-www-form-urlencoded;charset=utf-8")
 
 	res, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer res.Body.Close()
 	b, err := io.ReadAll(res.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return getEmailFromBody(&b)
+	return getIdentityFromBody(&b)
 }
 
-func (k *KakaoAuth) getUserEmail(ctx context.Context, t *oauth2.Token) (string, error) {
+func (k *KakaoAuth) getIdentity(ctx context.Context, t *oauth2.Token) (*model.Identity, error) {
 	client := k.OAuthConfig.Client(ctx, t)
 	body, err := authapi.GetBody(client, userInfoEndpoint)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return getEmailFromBody(&body)
+	return getIdentityFromBody(&body)
 }
 
-func getEmailFromBody(body *[]byte) (string, error) {
+func getIdentityFromBody(body *[]byte) (*model.Identity, error) {
 	info := &userInfo{}
 	if err := json.Unmarshal(*body, info); err != nil {
-		return "", err
+		return nil, err
 	}
 	if !(info.Account.IsEmailValid || info.Account.IsEmailVerified) {
-		return "", fmt.Errorf("%w, email valid: %v, verified: %v", authapi.ErrNoValidEmail, info.Account.IsEmailValid, info.Account.IsEmailVerified)
+		return nil, fmt.Errorf("%w, email valid: %v, verified: %v", authapi.ErrNoValidEmail, info.Account.IsEmailValid, info.Account.IsEmailVerified)
 	}
-	return info.Account.Email, nil
+	return &model.Identity{
+		AccountType: model.AccountTypeKakao,
+		Subject:     strconv.FormatInt(info.Id, 10),
+		Email:       info.Account.Email,
+	}, nil
 }
@@ -0,0 +1,139 @@
+package oidcAuth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	authapi "github.com/capdale/was/api/auth"
+	"github.com/capdale/was/config"
+	"github.com/capdale/was/model"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrNoIDToken    = errors.New("no id token")
+	ErrInvalidNonce = errors.New("invalid nonce")
+	ErrNoSubject    = errors.New("no subject")
+)
+
+var defaultScopes = []string{oidc.ScopeOpenID, "email", "profile"}
+
+// generic openid connect provider, configured by config.Oidc
+type OidcAuth struct {
+	accountType int
+	OAuthConfig *oauth2.Config
+	Verifier    *oidc.IDTokenVerifier
+	Claims      config.OidcClaims
+}
+
+// issuer discovery is done here, so issuer should be reachable at startup
+func New(ctx context.Context, c *config.Oidc) (*OidcAuth, error) {
+	provider, err := oidc.NewProvider(ctx, c.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+	claims := c.Claims
+	if claims.Subject == "" {
+		claims.Subject = "sub"
+	}
+	if claims.Email == "" {
+		claims.Email = "email"
+	}
+	if claims.EmailVerified == "" {
+		claims.EmailVerified = "email_verified"
+	}
+	if claims.Username == "" {
+		claims.Username = "preferred_username"
+	}
+
+	return &OidcAuth{
+		accountType: c.AccountType,
+		OAuthConfig: &oauth2.Config{
+			ClientID:     c.Id,
+			ClientSecret: c.Secret,
+			RedirectURL:  c.Redirect,
+			Scopes:       scopes,
+			Endpoint:     provider.Endpoint(),
+		},
+		Verifier: provider.Verifier(&oidc.Config{ClientID: c.Id}),
+		Claims:   claims,
+	}, nil
+}
+
+func (o *OidcAuth) AccountType() int {
+	return o.accountType
+}
+
+// nonce is derived from state, so id token is bound to login without more state
+func nonce(state string) string {
+	hashed := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(hashed[:])
+}
+
+func (o *OidcAuth) AuthCodeURL(state string, verifier string) string {
+	return o.OAuthConfig.AuthCodeURL(state, oidc.Nonce(nonce(state)), oauth2.S256ChallengeOption(verifier))
+}
+
+func (o *OidcAuth) Exchange(ctx context.Context, code string, state string, verifier string) (*model.Identity, string, error) {
+	token, err := o.OAuthConfig.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, "", err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, "", ErrNoIDToken
+	}
+
+	idToken, err := o.Verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, "", err
+	}
+	if idToken.Nonce != nonce(state) {
+		return nil, "", ErrInvalidNonce
+	}
+
+	claims := map[string]interface{}{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, "", err
+	}
+
+	subject := claimString(claims, o.Claims.Subject)
+	if subject == "" {
+		return nil, "", ErrNoSubject
+	}
+	email := claimString(claims, o.Claims.Email)
+	if email == "" || !claimBool(claims, o.Claims.EmailVerified) {
+		return nil, "", fmt.Errorf("%w, email: %q", authapi.ErrNoValidEmail, email)
+	}
+
+	return &model.Identity{
+		AccountType: o.accountType,
+		Subject:     subject,
+		Email:       email,
+	}, claimString(claims, o.Claims.Username), nil
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// some providers send boolean claim as string
+func claimBool(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true"
+	}
+	return false
+}
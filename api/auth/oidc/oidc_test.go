@@ -0,0 +1,206 @@
+package oidcAuth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	authapi "github.com/capdale/was/api/auth"
+	oidcAuth "github.com/capdale/was/api/auth/oidc"
+	"github.com/capdale/was/config"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const verifier = "verifier of pkce, verifier of pkce, verifier of pkce"
+
+// stub issuer, token endpoint return id token signed with claims
+type issuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+}
+
+func newIssuer(t *testing.T) *issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := &issuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                i.server.URL,
+			"authorization_endpoint":                i.server.URL + "/authorize",
+			"token_endpoint":                        i.server.URL + "/token",
+			"jwks_uri":                              i.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"alg": "RS256",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code_verifier") != verifier {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, i.claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	i.server = httptest.NewServer(mux)
+	t.Cleanup(i.server.Close)
+	return i
+}
+
+func nonceOf(t *testing.T, o *oidcAuth.OidcAuth, state string) string {
+	u, err := url.Parse(o.AuthCodeURL(state, verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Query().Get("code_challenge") != oauth2.S256ChallengeFromVerifier(verifier) {
+		t.Errorf("S256 code challenge is not sent")
+	}
+	return u.Query().Get("nonce")
+}
+
+func TestExchange(t *testing.T) {
+	i := newIssuer(t)
+	o, err := oidcAuth.New(context.Background(), &config.Oidc{
+		Name:        "test",
+		AccountType: 100,
+		Issuer:      i.server.URL,
+		Id:          "client",
+		Secret:      "secret",
+		Redirect:    "http://localhost/auth/test/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state := "state"
+	claims := func(override jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"iss":                i.server.URL,
+			"aud":                "client",
+			"sub":                "subject",
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              nonceOf(t, o, state),
+			"email":              "test@test.test",
+			"email_verified":     true,
+			"preferred_username": "tester",
+		}
+		for name, value := range override {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	var cases = []struct {
+		name   string
+		claims jwt.MapClaims
+		err    error
+	}{
+		{"valid", claims(nil), nil},
+		{"verified as string", claims(jwt.MapClaims{"email_verified": "true"}), nil},
+		{"unverified email", claims(jwt.MapClaims{"email_verified": false}), authapi.ErrNoValidEmail},
+		{"invalid nonce", claims(jwt.MapClaims{"nonce": "other"}), oidcAuth.ErrInvalidNonce},
+		{"no subject", claims(jwt.MapClaims{"sub": ""}), oidcAuth.ErrNoSubject},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			i.claims = tcase.claims
+			identity, username, err := o.Exchange(context.Background(), "code", state, verifier)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got %v, expected %v", err, tcase.err)
+			}
+			if err != nil {
+				return
+			}
+			if identity.AccountType != 100 || identity.Subject != "subject" || identity.Email != "test@test.test" {
+				t.Errorf("unexpected identity %+v", identity)
+			}
+			if username != "tester" {
+				t.Errorf("got %s, expected tester", username)
+			}
+		})
+	}
+
+	t.Run("other audience", func(t *testing.T) {
+		i.claims = claims(jwt.MapClaims{"aud": "other"})
+		if _, _, err := o.Exchange(context.Background(), "code", state, verifier); err == nil {
+			t.Error("expected error, but got nil")
+		}
+	})
+}
+
+func TestClaimsMapping(t *testing.T) {
+	i := newIssuer(t)
+	o, err := oidcAuth.New(context.Background(), &config.Oidc{
+		Name:        "test",
+		AccountType: 100,
+		Issuer:      i.server.URL,
+		Id:          "client",
+		Claims: config.OidcClaims{
+			Subject:       "oid",
+			Email:         "upn",
+			EmailVerified: "upn_verified",
+			Username:      "nickname",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	i.claims = jwt.MapClaims{
+		"iss":          i.server.URL,
+		"aud":          "client",
+		"sub":          "pairwise subject",
+		"exp":          time.Now().Add(time.Minute).Unix(),
+		"nonce":        nonceOf(t, o, "state"),
+		"oid":          "object id",
+		"upn":          "mapped@test.test",
+		"upn_verified": true,
+		"nickname":     "mapped",
+	}
+	identity, username, err := o.Exchange(context.Background(), "code", "state", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Subject != "object id" || identity.Email != "mapped@test.test" || username != "mapped" {
+		t.Errorf("unexpected identity %+v, username %s", identity, username)
+	}
+}
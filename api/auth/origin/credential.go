@@ -0,0 +1,157 @@
+package originAPI
+
+import (
+	"net/http"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/email"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/gin-gonic/gin"
+)
+
+type changePasswordForm struct {
+	CurrentPassword string `form:"current_password" json:"current_password" binding:"required,min=8,max=32"`
+	Password        string `form:"password" json:"password" binding:"required,min=8,max=32"`
+}
+
+func (o *OriginAPI) ChangePasswordHandler(ctx *gin.Context) {
+	form := &changePasswordForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	if !validatePassword(&form.Password) {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "password check error", ErrInvalidPasswordForm)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	if !o.confirmPassword(ctx, claimer, form.CurrentPassword) {
+		return
+	}
+
+	if err := o.DB.ChangePassword(claimer, form.Password); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "change password", err)
+		return
+	}
+
+	if err := o.Auth.RevokeOtherSessions(claimer, api.MustGetSession(ctx)); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "revoke other sessions", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+type createEmailChangeTicketForm struct {
+	Email    string `form:"email" json:"email" binding:"required,email"`
+	Password string `form:"password" json:"password" binding:"required,min=8,max=32"`
+}
+
+func (o *OriginAPI) CreateEmailChangeTicketHandler(ctx *gin.Context) {
+	form := &createEmailChangeTicketForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	if !o.confirmPassword(ctx, claimer, form.Password) {
+		return
+	}
+
+	emailUsed, err := o.DB.IsEmailUsed(form.Email)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "is email used", err)
+		return
+	}
+	if emailUsed {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "email already used"})
+		return
+	}
+
+	currentEmail, ticketUUID, err := o.DB.CreateEmailChangeTicket(claimer, api.MustGetSession(ctx), form.Email)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "create email change ticket", err)
+		return
+	}
+
+	changeLink := o.CreateEmailChangeLink(ticketUUID.String())
+	if err := o.Email.SendEmailChangeLink(ctx, form.Email, changeLink); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "create email error", err)
+		return
+	}
+	if err := o.Email.SendEmailChangeNotice(ctx, currentEmail, email.CensorEmail(form.Email)); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "create email error", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+type changeEmailForm struct {
+	Ticket string `form:"ticket" json:"ticket" binding:"required,uuid"`
+}
+
+func (o *OriginAPI) ChangeEmailHandler(ctx *gin.Context) {
+	form := &changeEmailForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	ticketUUID := binaryuuid.MustParse(form.Ticket)
+	claimer, sessionUID, err := o.DB.ChangeEmailViaTicket(&ticketUUID)
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		logger.ErrorWithCTX(ctx, "change email via ticket", err)
+		return
+	}
+
+	// session requested change is kept
+	if err := o.Auth.RevokeOtherSessions(claimer, sessionUID); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "revoke other sessions", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+type emailChangeTicketViewUri struct {
+	TicketUUID string `uri:"ticket" binding:"required,uuid"`
+}
+
+func (o *OriginAPI) EmailChangeTicketView(ctx *gin.Context) {
+	uri := &emailChangeTicketViewUri{}
+	if err := ctx.BindUri(uri); err != nil {
+		// TODO: change to 404 page
+		ctx.Status(http.StatusNotFound)
+		logger.ErrorWithCTX(ctx, "bind uri", err)
+		return
+	}
+
+	ticketUUID := binaryuuid.MustParse(uri.TicketUUID)
+
+	ticketEmail, err := o.DB.GetEmailByEmailChangeTicket(&ticketUUID)
+	if err != nil {
+		// TODO: change to 404 page
+		ctx.Status(http.StatusNotFound)
+		logger.ErrorWithCTX(ctx, "get email by email change ticket", err)
+		return
+	}
+
+	ctx.HTML(http.StatusOK, "email_change.tmpl", gin.H{
+		"endpoint": "/auth/email-change",
+		"ticket":   ticketUUID,
+		"email":    email.CensorEmail(ticketEmail),
+	})
+}
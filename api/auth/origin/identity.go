@@ -0,0 +1,84 @@
+package originAPI
+
+import (
+	"net/http"
+
+	"github.com/capdale/was/api"
+	"github.com/gin-gonic/gin"
+)
+
+type createPasswordForm struct {
+	Password string `form:"password" json:"password" binding:"required,min=8,max=32"`
+}
+
+// add password login to social user, username is used to login
+func (o *OriginAPI) CreatePasswordHandler(ctx *gin.Context) {
+	form := &createPasswordForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	if !validatePassword(&form.Password) {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "password check error", ErrInvalidPasswordForm)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	hasPassword, err := o.DB.HasPassword(claimer)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "has password", err)
+		return
+	}
+	if hasPassword {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "password already set"})
+		return
+	}
+
+	if err := o.DB.CreatePassword(claimer, form.Password); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "create password", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+type deletePasswordForm struct {
+	Password string `form:"password" json:"password" binding:"required,min=8,max=32"`
+}
+
+// remove password login, totp and recovery codes are removed too
+func (o *OriginAPI) DeletePasswordHandler(ctx *gin.Context) {
+	form := &deletePasswordForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	if !o.confirmPassword(ctx, claimer, form.Password) {
+		return
+	}
+
+	identities, err := o.DB.GetIdentities(claimer)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "get identities", err)
+		return
+	}
+	if len(*identities) < 1 {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "last login method cannot be removed"})
+		return
+	}
+
+	if err := o.DB.DeletePassword(claimer); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "delete password", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
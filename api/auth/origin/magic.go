@@ -0,0 +1,172 @@
+package originAPI
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/email"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	MagicLinkNonceCookie = "magic_link_nonce"
+	magicLinkCookiePath  = "/auth/magic-link"
+	magicLinkExpiration  = time.Minute * 10 // same as ticket expiration
+)
+
+func hashMagicLinkNonce(nonce string) []byte {
+	hashed := sha256.Sum256([]byte(nonce))
+	return hashed[:]
+}
+
+type createMagicLinkForm struct {
+	Email string `form:"email" json:"email" binding:"required,email"`
+}
+
+// nonce is given to requesting device as cookie and body (for app), login link works only with the nonce
+func (o *OriginAPI) CreateMagicLinkHandler(ctx *gin.Context) {
+	form := &createMagicLinkForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	if o.isTicketThrottled(ctx, form.Email) {
+		return
+	}
+
+	rand32, err := auth.RandToken(32)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "generate random token", err)
+		return
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(*rand32)
+
+	// unknown email is accepted with nonce too, not to expose whether email is registered
+	ticketUUID, err := o.DB.CreateMagicLinkTicket(form.Email, hashMagicLinkNonce(nonce))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		o.respondMagicLinkNonce(ctx, nonce)
+		return
+	} else if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "create magic link ticket", err)
+		return
+	}
+
+	magicLink := o.CreateMagicLink(ticketUUID.String())
+	if err := o.Email.SendMagicLink(ctx, form.Email, magicLink); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "create email error", err)
+		return
+	}
+	o.respondMagicLinkNonce(ctx, nonce)
+}
+
+func (o *OriginAPI) respondMagicLinkNonce(ctx *gin.Context, nonce string) {
+	o.Auth.SetDeviceCookie(ctx, MagicLinkNonceCookie, nonce, int(magicLinkExpiration.Seconds()), magicLinkCookiePath)
+	ctx.JSON(http.StatusAccepted, gin.H{
+		"nonce": nonce,
+	})
+}
+
+type magicLinkLoginForm struct {
+	Ticket string `json:"ticket" binding:"required,uuid"`
+	Nonce  string `json:"nonce" binding:"max=64"` // app send nonce in body, browser send it as cookie
+}
+
+func (o *OriginAPI) MagicLinkLoginHandler(ctx *gin.Context) {
+	form := &magicLinkLoginForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	nonce := form.Nonce
+	if nonce == "" {
+		if cookie, err := ctx.Request.Cookie(MagicLinkNonceCookie); err == nil {
+			nonce = cookie.Value
+		}
+	}
+	if nonce == "" {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid ticket"})
+		return
+	}
+
+	ticketUUID := binaryuuid.MustParse(form.Ticket)
+	claimer, err := o.DB.LoginViaMagicLinkTicket(&ticketUUID, hashMagicLinkNonce(nonce))
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid ticket"})
+		logger.ErrorWithCTX(ctx, "login via magic link ticket", err)
+		return
+	}
+	o.Auth.SetDeviceCookie(ctx, MagicLinkNonceCookie, "", -1, magicLinkCookiePath)
+
+	// magic link replaces password only, second factor is still required
+	hasPassword, err := o.DB.HasPassword(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "has password", err)
+		return
+	}
+	if hasPassword {
+		_, totpEnabled, err := o.DB.GetTOTP(claimer)
+		if err != nil {
+			api.BasicInternalServerError(ctx)
+			logger.ErrorWithCTX(ctx, "get totp", err)
+			return
+		}
+		if totpEnabled {
+			o.issueMfaChallenge(ctx, claimer)
+			return
+		}
+	}
+
+	userAgent := ctx.Request.UserAgent()
+	tokenString, refreshToken, err := o.Auth.IssueToken(*claimer, &userAgent, ctx.ClientIP())
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue token", err)
+		return
+	}
+	o.Auth.RespondToken(ctx, gin.H{}, tokenString, refreshToken)
+}
+
+type magicLinkTicketViewUri struct {
+	TicketUUID string `uri:"ticket" binding:"required,uuid"`
+}
+
+func (o *OriginAPI) MagicLinkTicketView(ctx *gin.Context) {
+	uri := &magicLinkTicketViewUri{}
+	if err := ctx.BindUri(uri); err != nil {
+		// TODO: change to 404 page
+		ctx.Status(http.StatusNotFound)
+		logger.ErrorWithCTX(ctx, "bind uri", err)
+		return
+	}
+
+	ticketUUID := binaryuuid.MustParse(uri.TicketUUID)
+
+	ticketEmail, err := o.DB.GetEmailByMagicLinkTicket(&ticketUUID)
+	if err != nil {
+		// TODO: change to 404 page
+		ctx.Status(http.StatusNotFound)
+		logger.ErrorWithCTX(ctx, "get email by magic link ticket", err)
+		return
+	}
+
+	ctx.HTML(http.StatusOK, "magic_link.tmpl", gin.H{
+		"endpoint": "/auth/magic-link/login",
+		"ticket":   ticketUUID,
+		"email":    email.CensorEmail(ticketEmail),
+	})
+}
@@ -0,0 +1,246 @@
+package originAPI
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/auth/totp"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	totpIssuer             = "Modoo Collection"
+	recoveryCodeCount      = 10
+	mfaChallengeExpiration = time.Minute * 5
+	mfaChallengeMaxTries   = 5
+)
+
+func hashRecoveryCode(code string) []byte {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	hashed := sha256.Sum256([]byte(normalized))
+	return hashed[:]
+}
+
+func generateRecoveryCodes() (codes []string, hashedCodes [][]byte, err error) {
+	codes = make([]string, recoveryCodeCount)
+	hashedCodes = make([][]byte, recoveryCodeCount)
+	for i := range codes {
+		randBytes, err := auth.RandToken(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		code := hex.EncodeToString(*randBytes)
+		codes[i] = code[:5] + "-" + code[5:]
+		hashedCodes[i] = hashRecoveryCode(code)
+	}
+	return
+}
+
+// code is totp code or recovery code
+func (o *OriginAPI) verifySecondFactor(claimer *claimer.Claimer, code string) (bool, error) {
+	secret, enabled, err := o.DB.GetTOTP(claimer)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		return false, nil
+	}
+	if step, ok := totp.Validate(secret, code, time.Now()); ok {
+		return o.DB.UseTOTPStep(claimer, step)
+	}
+	return o.DB.UseRecoveryCode(claimer, hashRecoveryCode(code))
+}
+
+func (o *OriginAPI) StartTOTPHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+
+	_, enabled, err := o.DB.GetTOTP(claimer)
+	if err != nil {
+		// only origin account has totp
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "get totp", err)
+		return
+	}
+	if enabled {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "totp already enabled"})
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "generate totp secret", err)
+		return
+	}
+
+	username, err := o.DB.StartTOTP(claimer, secret)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "start totp", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"secret": totp.EncodeSecret(secret),
+		"uri":    totp.ProvisioningURI(totpIssuer, username, secret),
+	})
+}
+
+type totpCodeForm struct {
+	Code string `json:"code" form:"code" binding:"required,max=32"`
+}
+
+func (o *OriginAPI) EnableTOTPHandler(ctx *gin.Context) {
+	form := &totpCodeForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	secret, enabled, err := o.DB.GetTOTP(claimer)
+	if err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "get totp", err)
+		return
+	}
+	if enabled {
+		ctx.JSON(http.StatusConflict, gin.H{"message": "totp already enabled"})
+		return
+	}
+
+	step, ok := totp.Validate(secret, form.Code, time.Now())
+	if len(secret) == 0 || !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid code"})
+		return
+	}
+
+	codes, hashedCodes, err := generateRecoveryCodes()
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "generate recovery codes", err)
+		return
+	}
+
+	if err := o.DB.EnableTOTP(claimer, step, &hashedCodes); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "enable totp", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"recovery_codes": codes,
+	})
+}
+
+func (o *OriginAPI) DisableTOTPHandler(ctx *gin.Context) {
+	form := &totpCodeForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	ok, err := o.verifySecondFactor(claimer, form.Code)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "verify second factor", err)
+		return
+	}
+	if !ok {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid code"})
+		return
+	}
+
+	if err := o.DB.DisableTOTP(claimer); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "disable totp", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// password verified, second factor required
+func (o *OriginAPI) issueMfaChallenge(ctx *gin.Context, claimer *claimer.Claimer) {
+	rand32, err := auth.RandToken(32)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "generate random token", err)
+		return
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(*rand32)
+	if err := o.Store.SetMfaChallenge(challenge, claimer.String(), mfaChallengeExpiration); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "set mfa challenge", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"mfa_required": true,
+		"mfa_token":    challenge,
+	})
+}
+
+type loginMfaForm struct {
+	MfaToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required,max=32"`
+}
+
+func (o *OriginAPI) LoginMfaHandler(ctx *gin.Context) {
+	form := &loginMfaForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	claimerString, err := o.Store.GetMfaChallenge(form.MfaToken)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid mfa token"})
+		logger.ErrorWithCTX(ctx, "get mfa challenge", err)
+		return
+	}
+	claimer, err := claimer.Parse(claimerString)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "parse claimer", err)
+		return
+	}
+
+	ok, err := o.verifySecondFactor(&claimer, form.Code)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "verify second factor", err)
+		return
+	}
+	if !ok {
+		if err := o.Store.FailMfaChallenge(form.MfaToken, mfaChallengeMaxTries); err != nil {
+			logger.ErrorWithCTX(ctx, "fail mfa challenge", err)
+		}
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid code"})
+		return
+	}
+
+	// challenge is single use
+	if err := o.Store.PopMfaChallenge(form.MfaToken); err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid mfa token"})
+		logger.ErrorWithCTX(ctx, "pop mfa challenge", err)
+		return
+	}
+
+	userAgent := ctx.Request.UserAgent()
+	tokenString, refreshToken, err := o.Auth.IssueToken(claimer, &userAgent, ctx.ClientIP())
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue token", err)
+		return
+	}
+	o.Auth.RespondToken(ctx, gin.H{}, tokenString, refreshToken)
+}
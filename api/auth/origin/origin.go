@@ -1,15 +1,19 @@
 package originAPI
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/capdale/was/auth"
 	"github.com/capdale/was/email"
 	baselogger "github.com/capdale/was/logger"
+	"github.com/capdale/was/model"
 	"github.com/capdale/was/types/binaryuuid"
 	"github.com/capdale/was/types/claimer"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 var logger = baselogger.Logger
@@ -21,21 +25,61 @@ type database interface {
 	GetEmailByTicket(ticketUUID *binaryuuid.UUID) (string, error)
 	CreateOriginViaTicket(ticket *binaryuuid.UUID, username string, password string) error
 	GetOriginUserClaim(username string, password string) (*claimer.Claimer, error)
+	StartTOTP(claimer *claimer.Claimer, secret []byte) (string, error)
+	GetTOTP(claimer *claimer.Claimer) ([]byte, bool, error)
+	EnableTOTP(claimer *claimer.Claimer, step int64, hashedRecoveryCodes *[][]byte) error
+	DisableTOTP(claimer *claimer.Claimer) error
+	UseTOTPStep(claimer *claimer.Claimer, step int64) (bool, error)
+	UseRecoveryCode(claimer *claimer.Claimer, hashedCode []byte) (bool, error)
+	CreatePasswordResetTicket(email string) (*binaryuuid.UUID, error)
+	GetEmailByPasswordResetTicket(ticketUUID *binaryuuid.UUID) (string, error)
+	ResetPasswordViaTicket(ticketUUID *binaryuuid.UUID, password string) (*claimer.Claimer, error)
+	VerifyPassword(claimer *claimer.Claimer, password string) (bool, error)
+	ChangePassword(claimer *claimer.Claimer, password string) error
+	CreateEmailChangeTicket(claimer *claimer.Claimer, sessionUID *binaryuuid.UUID, email string) (string, *binaryuuid.UUID, error)
+	GetEmailByEmailChangeTicket(ticketUUID *binaryuuid.UUID) (string, error)
+	ChangeEmailViaTicket(ticketUUID *binaryuuid.UUID) (*claimer.Claimer, *binaryuuid.UUID, error)
+	GetOriginEmailByUsername(username string) (string, error)
+	HasPassword(claimer *claimer.Claimer) (bool, error)
+	CreatePassword(claimer *claimer.Claimer, password string) error
+	DeletePassword(claimer *claimer.Claimer) error
+	GetIdentities(claimer *claimer.Claimer) (*[]*model.IdentityAPI, error)
+	CreateMagicLinkTicket(email string, hashedNonce []byte) (*binaryuuid.UUID, error)
+	GetEmailByMagicLinkTicket(ticketUUID *binaryuuid.UUID) (string, error)
+	LoginViaMagicLinkTicket(ticketUUID *binaryuuid.UUID, hashedNonce []byte) (*claimer.Claimer, error)
+}
+
+type store interface {
+	SetMfaChallenge(challenge string, claimer string, expired time.Duration) error
+	GetMfaChallenge(challenge string) (string, error)
+	FailMfaChallenge(challenge string, maxTries int64) error
+	PopMfaChallenge(challenge string) error
+	GetLockout(key string) (time.Duration, error)
+	FailAttempt(key string, threshold int64, window time.Duration, lockout time.Duration, maxLockout time.Duration) (int64, time.Duration, error)
+	ResetAttempts(key string) error
 }
 
 type OriginAPI struct {
-	DB               database
-	Auth             *auth.Auth
-	Email            email.EmailService
-	CreateVerifyLink func(identifier string) string
+	DB                    database
+	Auth                  *auth.Auth
+	Store                 store
+	Email                 email.EmailService
+	CreateVerifyLink      func(identifier string) string
+	CreateResetLink       func(identifier string) string
+	CreateEmailChangeLink func(identifier string) string
+	CreateMagicLink       func(identifier string) string
 }
 
-func New(d database, auth *auth.Auth, email email.EmailService, createVerifyLink func(string) string) *OriginAPI {
+func New(d database, auth *auth.Auth, store store, email email.EmailService, createVerifyLink func(string) string, createResetLink func(string) string, createEmailChangeLink func(string) string, createMagicLink func(string) string) *OriginAPI {
 	return &OriginAPI{
-		DB:               d,
-		Auth:             auth,
-		Email:            email,
-		CreateVerifyLink: createVerifyLink,
+		DB:                    d,
+		Auth:                  auth,
+		Store:                 store,
+		Email:                 email,
+		CreateVerifyLink:      createVerifyLink,
+		CreateResetLink:       createResetLink,
+		CreateEmailChangeLink: createEmailChangeLink,
+		CreateMagicLink:       createMagicLink,
 	}
 }
 
@@ -52,6 +96,10 @@ func (o *OriginAPI) CreateEmailTicketHandler(ctx *gin.Context) {
 		return
 	}
 
+	if o.isTicketThrottled(ctx, form.Email) {
+		return
+	}
+
 	ticketUUID, err := o.DB.CreateTicketByEmail(form.Email)
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
@@ -134,8 +182,8 @@ func (o *OriginAPI) RegisterTicketView(ctx *gin.Context) {
 }
 
 type loginForm struct {
-	Username string `json:"username" binding:"required,min=6,max=12"`
-	Password string `json:"password" binding:"required,min=8,max=22"`
+	Username string `json:"username" binding:"required,min=6,max=20"`
+	Password string `json:"password" binding:"required,min=8,max=32"`
 }
 
 func (o *OriginAPI) LoginHandler(ctx *gin.Context) {
@@ -146,22 +194,40 @@ func (o *OriginAPI) LoginHandler(ctx *gin.Context) {
 		return
 	}
 
+	if o.isLockedOut(ctx, loginIPThrottle, ctx.ClientIP()) || o.isLockedOut(ctx, loginUsernameThrottle, form.Username) {
+		return
+	}
+
 	claimer, err := o.DB.GetOriginUserClaim(form.Username, form.Password)
-	if err != nil {
-		ctx.Status(http.StatusUnauthorized)
+	if errors.Is(err, model.ErrPasswordMismatch) || errors.Is(err, gorm.ErrRecordNotFound) {
+		o.failLogin(ctx, form.Username)
+		logger.ErrorWithCTX(ctx, "get origin user", err)
+		return
+	} else if err != nil {
+		// outage is not failed attempt, user must not be locked out by it
+		ctx.Status(http.StatusInternalServerError)
 		logger.ErrorWithCTX(ctx, "get origin user", err)
 		return
 	}
+	o.resetAttempts(ctx, loginUsernameThrottle, form.Username)
+
+	_, totpEnabled, err := o.DB.GetTOTP(claimer)
+	if err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "get totp", err)
+		return
+	}
+	if totpEnabled {
+		o.issueMfaChallenge(ctx, claimer)
+		return
+	}
 
 	userAgent := ctx.Request.UserAgent()
-	tokenString, refreshToken, err := o.Auth.IssueToken(*claimer, &userAgent)
+	tokenString, refreshToken, err := o.Auth.IssueToken(*claimer, &userAgent, ctx.ClientIP())
 	if err != nil {
 		ctx.Status(http.StatusInternalServerError)
 		logger.ErrorWithCTX(ctx, "issue token", err)
 		return
 	}
-	ctx.JSON(http.StatusOK, gin.H{
-		"access_token":  tokenString,
-		"refresh_token": refreshToken,
-	})
+	o.Auth.RespondToken(ctx, gin.H{}, tokenString, refreshToken)
 }
@@ -0,0 +1,202 @@
+package originAPI_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	originAPI "github.com/capdale/was/api/auth/origin"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/config"
+	"github.com/capdale/was/database"
+	"github.com/capdale/was/logger"
+	"github.com/capdale/was/test"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// in memory store, expiration is ignored
+type memStore struct {
+	mu       sync.Mutex
+	attempts map[string]int64
+	lockouts map[string]time.Duration
+}
+
+func newMemStore() *memStore {
+	return &memStore{attempts: map[string]int64{}, lockouts: map[string]time.Duration{}}
+}
+
+func (m *memStore) SetMfaChallenge(challenge string, claimer string, expired time.Duration) error {
+	return errors.New("not implemented")
+}
+
+func (m *memStore) GetMfaChallenge(challenge string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (m *memStore) FailMfaChallenge(challenge string, maxTries int64) error {
+	return errors.New("not implemented")
+}
+
+func (m *memStore) PopMfaChallenge(challenge string) error {
+	return errors.New("not implemented")
+}
+
+func (m *memStore) GetLockout(key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lockouts[key], nil
+}
+
+func (m *memStore) FailAttempt(key string, threshold int64, window time.Duration, lockout time.Duration, maxLockout time.Duration) (int64, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts[key]++
+	if m.attempts[key] < threshold {
+		return m.attempts[key], 0, nil
+	}
+	m.lockouts[key] = lockout
+	return m.attempts[key], lockout, nil
+}
+
+func (m *memStore) ResetAttempts(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.attempts, key)
+	return nil
+}
+
+// origin api with sqlite database and one user
+func newTestOrigin(t *testing.T) (*originAPI.OriginAPI, *database.DB, *claimer.Claimer) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(zap.NewNop())
+
+	tmpDir := test.NewTmpDir("was_origin")
+	d, err := database.NewSQLite(&config.SQLite{
+		Path: tmpDir.Join("test.db"),
+	}, math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		d.Close()
+		tmpDir.Close()
+	})
+
+	ticket, _ := d.CreateTicketByEmail("test@test.test")
+	if err := d.CreateOriginViaTicket(ticket, "testuser", "Testtest1234!@"); err != nil {
+		t.Fatal(err)
+	}
+	claimer, err := d.GetOriginUserClaim("testuser", "Testtest1234!@")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := auth.New(d, nil, &config.Key{
+		Jwtkey:     "jwtkey of test, longer than 32 bytes",
+		RefreshKey: "refreshKey of test, longer than 32 bytes",
+		Issuer:     "https://test",
+		Audience:   "https://test",
+	}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return originAPI.New(d, a, newMemStore(), nil, nil, nil, nil, nil), d, claimer
+}
+
+func request(r *gin.Engine, method string, path string, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestConfirmPasswordThrottle(t *testing.T) {
+	o, _, claimer := newTestOrigin(t)
+	r := gin.New()
+	r.DELETE("/password", func(ctx *gin.Context) {
+		ctx.Set("claimer", claimer)
+	}, o.DeletePasswordHandler)
+
+	wrong := gin.H{"password": "Wrongpass1234!@"}
+	for i := 1; i < 5; i++ {
+		if w := request(r, http.MethodDelete, "/password", wrong); w.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: got %d, expected %d", i, w.Code, http.StatusUnauthorized)
+		}
+	}
+	w := request(r, http.MethodDelete, "/password", wrong)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("got %d, expected %d with Retry-After", w.Code, http.StatusTooManyRequests)
+	}
+	// right password is not checked while locked
+	if w := request(r, http.MethodDelete, "/password", gin.H{"password": "Testtest1234!@"}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("got %d, expected %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestLoginFailureCount(t *testing.T) {
+	o, d, _ := newTestOrigin(t)
+	store := o.Store.(*memStore)
+	r := gin.New()
+	r.POST("/login", o.LoginHandler)
+
+	var cases = []struct {
+		name     string
+		username string
+		password string
+		want     int
+	}{
+		{"wrong password", "testuser", "Wrongpass1234!@", http.StatusUnauthorized},
+		{"unknown user", "nobody", "Testtest1234!@", http.StatusUnauthorized},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			w := request(r, http.MethodPost, "/login", gin.H{"username": tcase.username, "password": tcase.password})
+			if w.Code != tcase.want {
+				t.Errorf("got %d, expected %d", w.Code, tcase.want)
+			}
+			if store.attempts["login_username:"+tcase.username] != 1 {
+				t.Errorf("failed login is not counted")
+			}
+		})
+	}
+
+	t.Run("database outage", func(t *testing.T) {
+		sqlDB, _ := d.DB.DB()
+		sqlDB.Close()
+		w := request(r, http.MethodPost, "/login", gin.H{"username": "testuser", "password": "Testtest1234!@"})
+		if w.Code != http.StatusInternalServerError {
+			t.Errorf("got %d, expected %d", w.Code, http.StatusInternalServerError)
+		}
+		if store.attempts["login_username:testuser"] != 1 {
+			t.Errorf("outage is counted as failed login")
+		}
+	})
+}
+
+func TestCreateMagicLink(t *testing.T) {
+	o, d, _ := newTestOrigin(t)
+	r := gin.New()
+	r.POST("/magic-link", o.CreateMagicLinkHandler)
+
+	// unknown email is accepted like registered one
+	w := request(r, http.MethodPost, "/magic-link", gin.H{"email": "notexist@test.test"})
+	if w.Code != http.StatusAccepted {
+		t.Errorf("got %d, expected %d", w.Code, http.StatusAccepted)
+	}
+
+	sqlDB, _ := d.DB.DB()
+	sqlDB.Close()
+	w = request(r, http.MethodPost, "/magic-link", gin.H{"email": "test@test.test"})
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("database outage: got %d, expected %d", w.Code, http.StatusInternalServerError)
+	}
+}
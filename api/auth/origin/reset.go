@@ -0,0 +1,108 @@
+package originAPI
+
+import (
+	"net/http"
+
+	"github.com/capdale/was/email"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/gin-gonic/gin"
+)
+
+type createPasswordResetTicketForm struct {
+	Email string `form:"email" json:"email" binding:"required,email"`
+}
+
+func (o *OriginAPI) CreatePasswordResetTicketHandler(ctx *gin.Context) {
+	form := &createPasswordResetTicketForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	if o.isTicketThrottled(ctx, form.Email) {
+		return
+	}
+
+	// always accepted, not to expose whether email is registered
+	ticketUUID, err := o.DB.CreatePasswordResetTicket(form.Email)
+	if err != nil {
+		ctx.Status(http.StatusAccepted)
+		logger.ErrorWithCTX(ctx, "create password reset ticket", err)
+		return
+	}
+
+	resetLink := o.CreateResetLink(ticketUUID.String())
+	if err := o.Email.SendPasswordResetLink(ctx, form.Email, resetLink); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "create email error", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+type resetPasswordForm struct {
+	Ticket   string `form:"ticket" json:"ticket" binding:"required,uuid"`
+	Password string `form:"password" json:"password" binding:"required,min=8,max=32"`
+}
+
+func (o *OriginAPI) ResetPasswordHandler(ctx *gin.Context) {
+	form := &resetPasswordForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	if !validatePassword(&form.Password) {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "password check error", ErrInvalidPasswordForm)
+		return
+	}
+
+	ticketUUID := binaryuuid.MustParse(form.Ticket)
+	claimer, err := o.DB.ResetPasswordViaTicket(&ticketUUID, form.Password)
+	if err != nil {
+		ctx.Status(http.StatusNotFound)
+		logger.ErrorWithCTX(ctx, "reset password via ticket", err)
+		return
+	}
+
+	// refresh tokens are removed with password, revoke issued access tokens too
+	if err := o.Auth.RevokeAllTokens(claimer); err != nil {
+		ctx.Status(http.StatusInternalServerError)
+		logger.ErrorWithCTX(ctx, "revoke all tokens", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+type passwordResetTicketViewUri struct {
+	TicketUUID string `uri:"ticket" binding:"required,uuid"`
+}
+
+func (o *OriginAPI) PasswordResetTicketView(ctx *gin.Context) {
+	uri := &passwordResetTicketViewUri{}
+	if err := ctx.BindUri(uri); err != nil {
+		// TODO: change to 404 page
+		ctx.Status(http.StatusNotFound)
+		logger.ErrorWithCTX(ctx, "bind uri", err)
+		return
+	}
+
+	ticketUUID := binaryuuid.MustParse(uri.TicketUUID)
+
+	ticketEmail, err := o.DB.GetEmailByPasswordResetTicket(&ticketUUID)
+	if err != nil {
+		// TODO: change to 404 page
+		ctx.Status(http.StatusNotFound)
+		logger.ErrorWithCTX(ctx, "get email by password reset ticket", err)
+		return
+	}
+
+	ctx.HTML(http.StatusOK, "password_reset.tmpl", gin.H{
+		"endpoint": "/auth/password-reset",
+		"ticket":   ticketUUID,
+		"email":    email.CensorEmail(ticketEmail),
+	})
+}
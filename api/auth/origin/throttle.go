@@ -0,0 +1,125 @@
+package originAPI
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type throttle struct {
+	prefix     string
+	threshold  int64         // attempts before lockout
+	window     time.Duration // attempts are counted in window
+	lockout    time.Duration // first lockout, doubled for each attempt after threshold
+	maxLockout time.Duration
+}
+
+var (
+	loginUsernameThrottle = &throttle{"login_username", 5, time.Minute * 15, time.Minute, time.Hour}
+	loginIPThrottle       = &throttle{"login_ip", 20, time.Minute * 15, time.Minute, time.Hour}
+	ticketIPThrottle      = &throttle{"ticket_ip", 5, time.Hour, time.Minute * 5, time.Hour * 24}
+	ticketEmailThrottle   = &throttle{"ticket_email", 3, time.Hour, time.Minute * 5, time.Hour * 24}
+	passwordThrottle      = &throttle{"password_confirm", 5, time.Minute * 15, time.Minute, time.Hour}
+)
+
+func (t *throttle) key(identifier string) string {
+	return fmt.Sprintf("%s:%s", t.prefix, identifier)
+}
+
+func abortTooManyRequests(ctx *gin.Context, lockout time.Duration) {
+	ctx.Header("Retry-After", fmt.Sprint(int64(math.Ceil(lockout.Seconds()))))
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"message": "too many requests"})
+}
+
+// response 429 with Retry-After if identifier is locked
+func (o *OriginAPI) isLockedOut(ctx *gin.Context, t *throttle, identifier string) bool {
+	lockout, err := o.Store.GetLockout(t.key(identifier))
+	if err != nil {
+		// fail open, login is still protected by password
+		logger.ErrorWithCTX(ctx, "get lockout", err)
+		return false
+	}
+	if lockout <= 0 {
+		return false
+	}
+	abortTooManyRequests(ctx, lockout)
+	return true
+}
+
+// count attempt, return lockout started by this attempt and whether it is first lockout in window
+func (o *OriginAPI) failAttempt(ctx *gin.Context, t *throttle, identifier string) (time.Duration, bool) {
+	count, lockout, err := o.Store.FailAttempt(t.key(identifier), t.threshold, t.window, t.lockout, t.maxLockout)
+	if err != nil {
+		logger.ErrorWithCTX(ctx, "fail attempt", err)
+		return 0, false
+	}
+	if lockout > 0 {
+		logger.InfoWithCTX(ctx, "lockout", zap.String("throttle", t.prefix), zap.String("identifier", identifier), zap.Int64("attempts", count), zap.Duration("lockout", lockout))
+	}
+	return lockout, count == t.threshold
+}
+
+func (o *OriginAPI) resetAttempts(ctx *gin.Context, t *throttle, identifier string) {
+	if err := o.Store.ResetAttempts(t.key(identifier)); err != nil {
+		logger.ErrorWithCTX(ctx, "reset attempts", err)
+	}
+}
+
+// failed login counted per username and per ip, user is noticed when account locked first
+func (o *OriginAPI) failLogin(ctx *gin.Context, username string) {
+	o.failAttempt(ctx, loginIPThrottle, ctx.ClientIP())
+	lockout, first := o.failAttempt(ctx, loginUsernameThrottle, username)
+	if lockout <= 0 {
+		ctx.Status(http.StatusUnauthorized)
+		return
+	}
+
+	if first {
+		if email, err := o.DB.GetOriginEmailByUsername(username); err == nil {
+			if err := o.Email.SendAccountLockedNotice(ctx, email, lockout); err != nil {
+				logger.ErrorWithCTX(ctx, "create email error", err)
+			}
+		}
+	}
+	abortTooManyRequests(ctx, lockout)
+}
+
+// ticket email requests are counted per ip and per email whether succeed or not
+func (o *OriginAPI) isTicketThrottled(ctx *gin.Context, email string) bool {
+	if o.isLockedOut(ctx, ticketIPThrottle, ctx.ClientIP()) || o.isLockedOut(ctx, ticketEmailThrottle, email) {
+		return true
+	}
+	o.failAttempt(ctx, ticketIPThrottle, ctx.ClientIP())
+	o.failAttempt(ctx, ticketEmailThrottle, email)
+	return false
+}
+
+// current password confirmed by logged in user, counted per user not to be guessed with stolen session,
+// response 400, 401 or 429 if not confirmed
+func (o *OriginAPI) confirmPassword(ctx *gin.Context, claimer *claimer.Claimer, password string) bool {
+	if o.isLockedOut(ctx, passwordThrottle, claimer.String()) {
+		return false
+	}
+	ok, err := o.DB.VerifyPassword(claimer, password)
+	if err != nil {
+		// only origin account has password
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "verify password", err)
+		return false
+	}
+	if !ok {
+		if lockout, _ := o.failAttempt(ctx, passwordThrottle, claimer.String()); lockout > 0 {
+			abortTooManyRequests(ctx, lockout)
+			return false
+		}
+		ctx.JSON(http.StatusUnauthorized, gin.H{"message": "invalid password"})
+		return false
+	}
+	o.resetAttempts(ctx, passwordThrottle, claimer.String())
+	return true
+}
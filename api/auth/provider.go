@@ -0,0 +1,179 @@
+package authapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/capdale/was/api"
+	identityAPI "github.com/capdale/was/api/auth/identity"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/model"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const stateExpiration = time.Minute * 10
+
+var ErrInvalidProviderToken = errors.New("invalid token of provider")
+
+// social login provider, state, login and link are handled by ProviderAuth
+type Provider interface {
+	AccountType() int
+	// verifier is pkce code verifier, S256 challenge is sent
+	AuthCodeURL(state string, verifier string) string
+	// exchange code of callback, return verified identity and username suggested for new user
+	Exchange(ctx context.Context, code string, state string, verifier string) (*model.Identity, string, error)
+}
+
+// provider accept access token issued to native app
+type AccessTokenProvider interface {
+	Provider
+	ExchangeAccessToken(ctx context.Context, accessToken string) (*model.Identity, string, error)
+}
+
+type providerState interface {
+	SetState(state string, data []byte, expired time.Duration) error
+	PopState(state string) ([]byte, error)
+}
+
+type ProviderAuth struct {
+	State    providerState
+	Identity *identityAPI.IdentityAPI
+	Provider Provider
+}
+
+func NewProviderAuth(state providerState, identity *identityAPI.IdentityAPI, provider Provider) *ProviderAuth {
+	return &ProviderAuth{
+		State:    state,
+		Identity: identity,
+		Provider: provider,
+	}
+}
+
+// stored with state until callback
+type loginState struct {
+	Verifier string                   `json:"verifier"`
+	Redirect *identityAPI.AppRedirect `json:"redirect,omitempty"`
+}
+
+// app login with client_id, redirect_uri, code_challenge and code_challenge_method (S256),
+// result is redirected to allowed redirect uri of app
+func (p *ProviderAuth) LoginHandler(ctx *gin.Context) {
+	login := &loginState{Verifier: oauth2.GenerateVerifier()}
+	if clientId := ctx.Query("client_id"); clientId != "" {
+		redirect := &identityAPI.AppRedirect{
+			ClientId:      clientId,
+			RedirectURI:   ctx.Query("redirect_uri"),
+			CodeChallenge: ctx.Query("code_challenge"),
+			State:         ctx.Query("state"),
+		}
+		if !p.Identity.IsAllowedRedirect(redirect.ClientId, redirect.RedirectURI) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid redirect uri"})
+			return
+		}
+		if ctx.Query("code_challenge_method") != "S256" || redirect.CodeChallenge == "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "S256 code challenge required"})
+			return
+		}
+		login.Redirect = redirect
+	}
+
+	rand32, err := auth.RandToken(32)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "generate random token", err)
+		return
+	}
+	state := base64.StdEncoding.EncodeToString(*rand32)
+	if ctx.Query("intent") == "link" {
+		state = identityAPI.LinkStatePrefix + state
+	}
+	data, err := json.Marshal(login)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "marshal login state", err)
+		return
+	}
+	if err := p.State.SetState(state, data, stateExpiration); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "set state", err)
+		return
+	}
+	authCodeURL := p.Provider.AuthCodeURL(state, login.Verifier)
+	if ctx.Query("type") == "json" {
+		ctx.JSON(http.StatusOK, gin.H{"url": authCodeURL})
+		return
+	}
+	ctx.Redirect(http.StatusFound, authCodeURL)
+}
+
+func (p *ProviderAuth) CallbackHandler(ctx *gin.Context) {
+	state := ctx.Query("state")
+	data, err := p.State.PopState(state)
+	if err != nil {
+		api.BasicUnAuthorizedError(ctx)
+		logger.ErrorWithCTX(ctx, "cannot find state", err)
+		return
+	}
+	login := &loginState{}
+	if err := json.Unmarshal(data, login); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "unmarshal login state", err)
+		return
+	}
+
+	identity, username, err := p.Provider.Exchange(ctx.Request.Context(), ctx.Query("code"), state, login.Verifier)
+	if errors.Is(err, ErrNoValidEmail) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "no valid email"})
+		logger.ErrorWithCTX(ctx, "no valid email", err)
+		return
+	} else if err != nil {
+		api.BasicUnAuthorizedError(ctx)
+		logger.ErrorWithCTX(ctx, "exchange provider code", err)
+		return
+	}
+
+	p.complete(ctx, identity, username, strings.HasPrefix(state, identityAPI.LinkStatePrefix), login.Redirect)
+}
+
+type loginWithAccessTokenForm struct {
+	AccessToken string `json:"access_token" form:"access_token" binding:"required"`
+	Intent      string `json:"intent" form:"intent"`
+}
+
+func (p *ProviderAuth) LoginWithAccessTokenHandler(ctx *gin.Context) {
+	provider, ok := p.Provider.(AccessTokenProvider)
+	if !ok {
+		ctx.Status(http.StatusNotFound)
+		return
+	}
+
+	form := &loginWithAccessTokenForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "bind form", err)
+		return
+	}
+
+	identity, username, err := provider.ExchangeAccessToken(ctx.Request.Context(), form.AccessToken)
+	if err != nil {
+		ctx.Status(http.StatusBadRequest)
+		logger.ErrorWithCTX(ctx, "get user identity", err)
+		return
+	}
+
+	p.complete(ctx, identity, username, form.Intent == "link", nil)
+}
+
+func (p *ProviderAuth) complete(ctx *gin.Context, identity *model.Identity, username string, link bool, redirect *identityAPI.AppRedirect) {
+	if link {
+		p.Identity.Link(ctx, identity, redirect)
+		return
+	}
+	p.Identity.Login(ctx, identity, username, redirect)
+}
@@ -0,0 +1,66 @@
+package authapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func (a *AuthAPI) GetSessionsHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	currentSession := api.MustGetSession(ctx)
+
+	sessions, err := a.Auth.Sessions(claimer, currentSession)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "query sessions", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"sessions": sessions,
+	})
+}
+
+type revokeSessionUri struct {
+	SessionUUID string `uri:"uuid" binding:"required,uuid"`
+}
+
+func (a *AuthAPI) RevokeSessionHandler(ctx *gin.Context) {
+	uri := &revokeSessionUri{}
+	if err := ctx.BindUri(uri); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "bind uri", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	sessionUUID := binaryuuid.MustParse(uri.SessionUUID)
+
+	if err := a.Auth.RevokeSession(claimer, &sessionUUID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"message": "session not found"})
+			logger.ErrorWithCTX(ctx, "revoke session", err)
+			return
+		}
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "revoke session", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+func (a *AuthAPI) RevokeOtherSessionsHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	currentSession := api.MustGetSession(ctx)
+
+	if err := a.Auth.RevokeOtherSessions(claimer, currentSession); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "revoke other sessions", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
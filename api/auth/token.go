@@ -0,0 +1,82 @@
+package authapi
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	"github.com/gin-gonic/gin"
+)
+
+type createPersonalAccessTokenForm struct {
+	Name          string   `json:"name" binding:"required,max=64"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"` // 0 is never expired
+}
+
+func (a *AuthAPI) CreatePersonalAccessTokenHandler(ctx *gin.Context) {
+	form := &createPersonalAccessTokenForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	var expiredAt *time.Time
+	if form.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, form.ExpiresInDays)
+		expiredAt = &t
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	tokenString, token, err := a.Auth.IssuePersonalAccessToken(claimer, form.Name, form.Scopes, expiredAt)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidScope) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid scope"})
+			return
+		}
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue personal access token", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"token":   tokenString,
+		"details": token,
+	})
+}
+
+func (a *AuthAPI) GetPersonalAccessTokensHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	tokens, err := a.DB.GetPersonalAccessTokens(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get personal access tokens", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+	})
+}
+
+type deletePersonalAccessTokenUri struct {
+	Id uint64 `uri:"id" binding:"required"`
+}
+
+func (a *AuthAPI) DeletePersonalAccessTokenHandler(ctx *gin.Context) {
+	uri := &deletePersonalAccessTokenUri{}
+	if err := ctx.BindUri(uri); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "bind uri", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	if err := a.DB.DeletePersonalAccessToken(claimer, uri.Id); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "token not found"})
+		logger.ErrorWithCTX(ctx, "delete personal access token", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
@@ -0,0 +1,94 @@
+package webauthnAuth
+
+import (
+	"strings"
+
+	"github.com/capdale/was/model"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// webauthn.User of model.User, user handle is auth uuid
+type user struct {
+	user        *model.User
+	credentials []webauthn.Credential
+}
+
+func newUser(u *model.User, credentials *[]*model.WebauthnCredential) *user {
+	webauthnCredentials := make([]webauthn.Credential, len(*credentials))
+	for i, credential := range *credentials {
+		webauthnCredentials[i] = toWebauthnCredential(credential)
+	}
+	return &user{
+		user:        u,
+		credentials: webauthnCredentials,
+	}
+}
+
+func (u *user) WebAuthnID() []byte {
+	return u.user.AuthUUID[:]
+}
+
+func (u *user) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *user) WebAuthnDisplayName() string {
+	return u.user.Username
+}
+
+func (u *user) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (u *user) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *user) exclusions() []protocol.CredentialDescriptor {
+	descriptors := make([]protocol.CredentialDescriptor, len(u.credentials))
+	for i, credential := range u.credentials {
+		descriptors[i] = credential.Descriptor()
+	}
+	return descriptors
+}
+
+func toWebauthnCredential(c *model.WebauthnCredential) webauthn.Credential {
+	transports := []protocol.AuthenticatorTransport{}
+	if c.Transport != "" {
+		for _, transport := range strings.Split(c.Transport, ",") {
+			transports = append(transports, protocol.AuthenticatorTransport(transport))
+		}
+	}
+	return webauthn.Credential{
+		ID:              c.CredentialId,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			BackupEligible: c.BackupEligible,
+			BackupState:    c.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    c.AAGUID,
+			SignCount: c.SignCount,
+		},
+	}
+}
+
+func toModelCredential(c *webauthn.Credential) *model.WebauthnCredential {
+	transports := make([]string, len(c.Transport))
+	for i, transport := range c.Transport {
+		transports[i] = string(transport)
+	}
+	return &model.WebauthnCredential{
+		CredentialId:    c.ID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       strings.Join(transports, ","),
+		AAGUID:          c.Authenticator.AAGUID,
+		SignCount:       c.Authenticator.SignCount,
+		BackupEligible:  c.Flags.BackupEligible,
+		BackupState:     c.Flags.BackupState,
+	}
+}
@@ -0,0 +1,255 @@
+package webauthnAuth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	baseLogger "github.com/capdale/was/logger"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+var logger = baseLogger.Logger
+
+const sessionExpiration = time.Minute * 5
+
+var ErrCloneWarning = errors.New("authenticator may be cloned")
+
+type database interface {
+	GetWebauthnUser(claimer *claimer.Claimer) (*model.User, *[]*model.WebauthnCredential, error)
+	GetWebauthnUserByHandle(userHandle *binaryuuid.UUID) (*model.User, *[]*model.WebauthnCredential, error)
+	CreateWebauthnCredential(claimer *claimer.Claimer, credential *model.WebauthnCredential) error
+	UpdateWebauthnCredentialUsed(credentialId []byte, signCount uint32, backupState bool) error
+	GetWebauthnCredentials(claimer *claimer.Claimer) (*[]*model.WebauthnCredentialAPI, error)
+	DeleteWebauthnCredential(claimer *claimer.Claimer, credentialId uint64) error
+	CreateSecurityEvent(userId uint64, eventType string, sessionUID *binaryuuid.UUID, agent *string) error
+}
+
+type state interface {
+	SetWebauthnSession(session string, data []byte, expired time.Duration) error
+	PopWebauthnSession(session string) ([]byte, error)
+}
+
+type WebauthnAuth struct {
+	DB       database
+	Auth     *auth.Auth
+	State    state
+	WebAuthn *webauthn.WebAuthn
+}
+
+func New(database database, auth *auth.Auth, state state, webAuthn *webauthn.WebAuthn) *WebauthnAuth {
+	return &WebauthnAuth{
+		DB:       database,
+		Auth:     auth,
+		State:    state,
+		WebAuthn: webAuthn,
+	}
+}
+
+// store ceremony session data server side, client get session id
+func (w *WebauthnAuth) setSession(sessionData *webauthn.SessionData) (string, error) {
+	rand32, err := auth.RandToken(32)
+	if err != nil {
+		return "", err
+	}
+	session := base64.RawURLEncoding.EncodeToString(*rand32)
+	data, err := json.Marshal(sessionData)
+	if err != nil {
+		return "", err
+	}
+	if err := w.State.SetWebauthnSession(session, data, sessionExpiration); err != nil {
+		return "", err
+	}
+	return session, nil
+}
+
+func (w *WebauthnAuth) popSession(session string) (*webauthn.SessionData, error) {
+	data, err := w.State.PopWebauthnSession(session)
+	if err != nil {
+		return nil, err
+	}
+	sessionData := &webauthn.SessionData{}
+	if err := json.Unmarshal(data, sessionData); err != nil {
+		return nil, err
+	}
+	return sessionData, nil
+}
+
+func (w *WebauthnAuth) BeginRegistrationHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	u, credentials, err := w.DB.GetWebauthnUser(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get webauthn user", err)
+		return
+	}
+	user := newUser(u, credentials)
+
+	creation, sessionData, err := w.WebAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(user.exclusions()),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+	)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "begin registration", err)
+		return
+	}
+
+	session, err := w.setSession(sessionData)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "set webauthn session", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"session": session,
+		"options": creation,
+	})
+}
+
+func (w *WebauthnAuth) FinishRegistrationHandler(ctx *gin.Context) {
+	sessionData, err := w.popSession(ctx.Query("session"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid session"})
+		logger.ErrorWithCTX(ctx, "pop webauthn session", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	u, credentials, err := w.DB.GetWebauthnUser(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get webauthn user", err)
+		return
+	}
+
+	// session user id is checked, so other user's session is rejected
+	credential, err := w.WebAuthn.FinishRegistration(newUser(u, credentials), *sessionData, ctx.Request)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid credential"})
+		logger.ErrorWithCTX(ctx, "finish registration", err)
+		return
+	}
+
+	if err := w.DB.CreateWebauthnCredential(claimer, toModelCredential(credential)); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "create webauthn credential", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// discoverable login, user is found by user handle of passkey
+func (w *WebauthnAuth) BeginLoginHandler(ctx *gin.Context) {
+	assertion, sessionData, err := w.WebAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "begin login", err)
+		return
+	}
+
+	session, err := w.setSession(sessionData)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "set webauthn session", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"session": session,
+		"options": assertion,
+	})
+}
+
+func (w *WebauthnAuth) FinishLoginHandler(ctx *gin.Context) {
+	sessionData, err := w.popSession(ctx.Query("session"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid session"})
+		logger.ErrorWithCTX(ctx, "pop webauthn session", err)
+		return
+	}
+
+	var loginUser *model.User
+	credential, err := w.WebAuthn.FinishDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		handle, err := binaryuuid.FromBytes(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		u, credentials, err := w.DB.GetWebauthnUserByHandle(&handle)
+		if err != nil {
+			return nil, err
+		}
+		loginUser = u
+		return newUser(u, credentials), nil
+	}, *sessionData, ctx.Request)
+	if err != nil {
+		api.BasicUnAuthorizedError(ctx)
+		logger.ErrorWithCTX(ctx, "finish login", err)
+		return
+	}
+
+	userAgent := ctx.Request.UserAgent()
+	if credential.Authenticator.CloneWarning {
+		if err := w.DB.CreateSecurityEvent(loginUser.Id, model.SecurityEventWebauthnClone, &binaryuuid.UUID{}, &userAgent); err != nil {
+			logger.ErrorWithCTX(ctx, "create security event", err)
+		}
+		api.BasicUnAuthorizedError(ctx)
+		logger.ErrorWithCTX(ctx, "finish login", ErrCloneWarning)
+		return
+	}
+
+	if err := w.DB.UpdateWebauthnCredentialUsed(credential.ID, credential.Authenticator.SignCount, credential.Flags.BackupState); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "update webauthn credential", err)
+		return
+	}
+
+	claimer := claimer.New(&loginUser.AuthUUID)
+	tokenString, refreshToken, err := w.Auth.IssueToken(*claimer, &userAgent, ctx.ClientIP())
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "issue token", err)
+		return
+	}
+
+	w.Auth.RespondToken(ctx, gin.H{"username": loginUser.Username}, tokenString, refreshToken)
+}
+
+func (w *WebauthnAuth) GetCredentialsHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	credentials, err := w.DB.GetWebauthnCredentials(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get webauthn credentials", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"credentials": credentials,
+	})
+}
+
+func (w *WebauthnAuth) DeleteCredentialHandler(ctx *gin.Context) {
+	credentialId, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+	if err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "parse credential id", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	if err := w.DB.DeleteWebauthnCredential(claimer, credentialId); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "credential not found"})
+		logger.ErrorWithCTX(ctx, "delete webauthn credential", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
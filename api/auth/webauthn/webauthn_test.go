@@ -0,0 +1,331 @@
+package webauthnAuth_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	webauthnAuth "github.com/capdale/was/api/auth/webauthn"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/config"
+	"github.com/capdale/was/database"
+	"github.com/capdale/was/logger"
+	"github.com/capdale/was/test"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
+)
+
+const (
+	rpID     = "test.example"
+	rpOrigin = "https://test.example"
+)
+
+var b64 = base64.RawURLEncoding
+
+// in memory store of auth and webauthn session, expiration is ignored
+type memStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memStore) IsBlacklist(token string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.data["blacklist_"+token]
+	return ok, nil
+}
+
+func (m *memStore) SetBlacklist(token string, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data["blacklist_"+token] = nil
+	return nil
+}
+
+func (m *memStore) GetTokenEpoch(claimer string) (uint64, bool, error) {
+	return 0, false, nil
+}
+
+func (m *memStore) SetTokenEpoch(claimer string, epoch uint64, expiration time.Duration) error {
+	return nil
+}
+
+func (m *memStore) SetWebauthnSession(session string, data []byte, expired time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data["webauthn_"+session] = data
+	return nil
+}
+
+func (m *memStore) PopWebauthnSession(session string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data["webauthn_"+session]
+	if !ok {
+		return nil, errors.New("no session")
+	}
+	delete(m.data, "webauthn_"+session)
+	return data, nil
+}
+
+// software authenticator with one ES256 passkey
+type authenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	signCount    uint32
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialId := make([]byte, 16)
+	rand.Read(credentialId)
+	return &authenticator{key: key, credentialId: credentialId}
+}
+
+func clientData(t *testing.T, ceremony string, challenge string) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    rpOrigin,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// rp id hash, flags (user present, user verified, attested credential), sign count
+func (a *authenticator) authData(attested []byte) []byte {
+	rpIdHash := sha256.Sum256([]byte(rpID))
+	flags := byte(0x01 | 0x04)
+	if attested != nil {
+		flags |= 0x40
+	}
+	a.signCount++
+	data := append(rpIdHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	return append(data, attested...)
+}
+
+func (a *authenticator) create(t *testing.T, challenge string) []byte {
+	publicKey, err := webauthncbor.Marshal(&webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	attested := make([]byte, 16) // aaguid
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(a.credentialId)))
+	attested = append(attested, a.credentialId...)
+	attested = append(attested, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(attested),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialId),
+		"rawId": b64.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientData(t, "webauthn.create", challenge)),
+			"attestationObject": b64.EncodeToString(attestationObject),
+		},
+	})
+	return body
+}
+
+func (a *authenticator) get(t *testing.T, challenge string, userHandle []byte) []byte {
+	authData := a.authData(nil)
+	clientDataJSON := clientData(t, "webauthn.get", challenge)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"id":    b64.EncodeToString(a.credentialId),
+		"rawId": b64.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": map[string]string{
+			"clientDataJSON":    b64.EncodeToString(clientDataJSON),
+			"authenticatorData": b64.EncodeToString(authData),
+			"signature":         b64.EncodeToString(signature),
+			"userHandle":        b64.EncodeToString(userHandle),
+		},
+	})
+	return body
+}
+
+type ceremony struct {
+	Session string `json:"session"`
+	Options struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	} `json:"options"`
+}
+
+type server struct {
+	router  *gin.Engine
+	claimer *claimer.Claimer
+}
+
+func newServer(t *testing.T) *server {
+	gin.SetMode(gin.TestMode)
+	logger.Init(zap.NewNop())
+
+	tmpDir := test.NewTmpDir("was_webauthn")
+	d, err := database.NewSQLite(&config.SQLite{
+		Path: tmpDir.Join("test.db"),
+	}, math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		d.Close()
+		tmpDir.Close()
+	})
+	ticket, _ := d.CreateTicketByEmail("test@test.test")
+	if err := d.CreateOriginViaTicket(ticket, "testuser", "Testtest1234!@"); err != nil {
+		t.Fatal(err)
+	}
+	claimer, err := d.GetOriginUserClaim("testuser", "Testtest1234!@")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memStore{data: map[string][]byte{}}
+	a, err := auth.New(d, store, &config.Key{
+		Jwtkey:     "jwtkey of test, longer than 32 bytes",
+		RefreshKey: "refreshKey of test, longer than 32 bytes",
+		Issuer:     "https://test",
+		Audience:   "https://test",
+	}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webAuthn, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: "test",
+		RPOrigins:     []string{rpOrigin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := webauthnAuth.New(d, a, store, webAuthn)
+
+	// registration is authorized by test user
+	authorized := func(ctx *gin.Context) {
+		ctx.Set("claimer", claimer)
+	}
+	r := gin.New()
+	r.POST("/register/begin", authorized, w.BeginRegistrationHandler)
+	r.POST("/register/finish", authorized, w.FinishRegistrationHandler)
+	r.POST("/login/begin", w.BeginLoginHandler)
+	r.POST("/login/finish", w.FinishLoginHandler)
+	return &server{router: r, claimer: claimer}
+}
+
+func (s *server) post(t *testing.T, path string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *server) begin(t *testing.T, path string) *ceremony {
+	w := s.post(t, path, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("begin %s: got %d", path, w.Code)
+	}
+	c := &ceremony{}
+	if err := json.Unmarshal(w.Body.Bytes(), c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func (s *server) register(t *testing.T, a *authenticator) {
+	c := s.begin(t, "/register/begin")
+	w := s.post(t, "/register/finish?session="+c.Session, a.create(t, c.Options.PublicKey.Challenge))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("finish registration: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	s := newServer(t)
+	a := newAuthenticator(t)
+	s.register(t, a)
+
+	// response to other challenge is rejected
+	other := newAuthenticator(t)
+	c := s.begin(t, "/register/begin")
+	w := s.post(t, "/register/finish?session="+c.Session, other.create(t, b64.EncodeToString([]byte("other challenge, other challenge"))))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("bad challenge: got %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	s := newServer(t)
+	a := newAuthenticator(t)
+	s.register(t, a)
+	userHandle := s.claimer[:]
+
+	c := s.begin(t, "/login/begin")
+	w := s.post(t, "/login/finish?session="+c.Session, a.get(t, c.Options.PublicKey.Challenge, userHandle))
+	if w.Code != http.StatusOK {
+		t.Fatalf("finish login: got %d %s", w.Code, w.Body.String())
+	}
+	body := map[string]string{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["username"] != "testuser" || body["access_token"] == "" {
+		t.Errorf("unexpected response %v", body)
+	}
+
+	// session is single use
+	w = s.post(t, "/login/finish?session="+c.Session, a.get(t, c.Options.PublicKey.Challenge, userHandle))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("reused session: got %d, expected %d", w.Code, http.StatusBadRequest)
+	}
+
+	// response to other challenge is rejected
+	c = s.begin(t, "/login/begin")
+	w = s.post(t, "/login/finish?session="+c.Session, a.get(t, b64.EncodeToString([]byte("other challenge, other challenge")), userHandle))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("bad challenge: got %d, expected %d", w.Code, http.StatusUnauthorized)
+	}
+}
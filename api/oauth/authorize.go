@@ -0,0 +1,176 @@
+package oauthAPI
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth/scope"
+	"github.com/capdale/was/model"
+	"github.com/gin-gonic/gin"
+)
+
+const authorizationCodeExpiration = time.Minute
+
+var ErrInvalidRedirectURI = errors.New("redirect uri is not registered")
+
+type authorizationRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientId            string `form:"client_id" json:"client_id" binding:"required,max=64"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri" binding:"required"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// unknown client or redirect uri is never redirected, RFC 6749 section 4.1.2.1
+func (o *OAuthAPI) getClient(req *authorizationRequest) (*model.OAuthClient, error) {
+	client, err := o.DB.GetOAuthClient(req.ClientId)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(strings.Fields(client.RedirectURIs), req.RedirectURI) {
+		return nil, ErrInvalidRedirectURI
+	}
+	return client, nil
+}
+
+// error code redirected to client, empty if request is valid
+func (req *authorizationRequest) validate(client *model.OAuthClient) string {
+	if req.ResponseType != "code" {
+		return "unsupported_response_type"
+	}
+	// PKCE is required for every client
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return "invalid_request"
+	}
+	scopes := strings.Fields(req.Scope)
+	if !isValidScopes(scopes) || !scope.HasAll(client.Scopes, scopes) {
+		return "invalid_scope"
+	}
+	return ""
+}
+
+func (req *authorizationRequest) redirect(values url.Values) string {
+	u, _ := url.Parse(req.RedirectURI) // checked when client registered
+	query := u.Query()
+	for key, value := range values {
+		query[key] = value
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// consent screen, user approve or deny with AuthorizeHandler
+func (o *OAuthAPI) AuthorizeView(ctx *gin.Context) {
+	api.DenyFraming(ctx)
+	// consent is submitted with session cookie
+	if !o.Auth.IsCookieEnabled() {
+		ctx.HTML(http.StatusNotImplemented, "oauth_consent.tmpl", gin.H{"error": "sign in on web is not enabled on this server"})
+		return
+	}
+
+	req := &authorizationRequest{}
+	if err := ctx.ShouldBindQuery(req); err != nil {
+		ctx.HTML(http.StatusBadRequest, "oauth_consent.tmpl", gin.H{"error": "invalid request"})
+		logger.ErrorWithCTX(ctx, "bind query", err)
+		return
+	}
+	client, err := o.getClient(req)
+	if err != nil {
+		ctx.HTML(http.StatusBadRequest, "oauth_consent.tmpl", gin.H{"error": "invalid client"})
+		logger.ErrorWithCTX(ctx, "get oauth client", err)
+		return
+	}
+	if code := req.validate(client); code != "" {
+		ctx.Redirect(http.StatusFound, req.redirect(url.Values{"error": {code}}))
+		return
+	}
+
+	ctx.HTML(http.StatusOK, "oauth_consent.tmpl", gin.H{
+		"endpoint": "/oauth/authorize",
+		"client":   client.Name,
+		"scopes":   strings.Fields(req.Scope),
+		"request":  req,
+	})
+}
+
+type authorizeForm struct {
+	authorizationRequest
+	Approve bool `json:"approve"`
+}
+
+type authorizationCode struct {
+	Claimer       string `json:"claimer"`
+	ClientId      string `json:"client_id"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scopes        string `json:"scopes"`
+	CodeChallenge string `json:"code_challenge"`
+}
+
+// logged in user decide, consent page navigate to returned redirect
+func (o *OAuthAPI) AuthorizeHandler(ctx *gin.Context) {
+	form := &authorizeForm{}
+	if err := ctx.ShouldBindJSON(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+	req := &form.authorizationRequest
+	client, err := o.getClient(req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid client"})
+		logger.ErrorWithCTX(ctx, "get oauth client", err)
+		return
+	}
+	if code := req.validate(client); code != "" {
+		ctx.JSON(http.StatusOK, gin.H{"redirect": req.redirect(url.Values{"error": {code}})})
+		return
+	}
+	if !form.Approve {
+		ctx.JSON(http.StatusOK, gin.H{"redirect": req.redirect(url.Values{"error": {"access_denied"}})})
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	scopes := scope.Join(strings.Fields(req.Scope))
+	if err := o.DB.SaveOAuthGrant(claimer, client.Id, scopes); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "save oauth grant", err)
+		return
+	}
+
+	code, err := randString(32)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "generate random token", err)
+		return
+	}
+	data, err := json.Marshal(&authorizationCode{
+		Claimer:       claimer.String(),
+		ClientId:      client.ClientId,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+	})
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "marshal authorization code", err)
+		return
+	}
+	if err := o.State.SetAuthorizationCode(code, data, authorizationCodeExpiration); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "set authorization code", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{"redirect": req.redirect(url.Values{"code": {code}})})
+}
@@ -0,0 +1,54 @@
+package oauthAPI_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	oauthAPI "github.com/capdale/was/api/oauth"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/config"
+	"github.com/capdale/was/logger"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func TestAuthorizeView(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(zap.NewNop())
+
+	var cases = []struct {
+		name   string
+		cookie *config.Cookie
+		want   int
+	}{
+		{"bearer only", nil, http.StatusNotImplemented},
+		{"cookie mode", &config.Cookie{}, http.StatusBadRequest}, // request without query
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			a, err := auth.New(nil, nil, &config.Key{
+				Jwtkey:     "jwtkey of test, longer than 32 bytes",
+				RefreshKey: "refreshKey of test, longer than 32 bytes",
+				Issuer:     "https://test",
+				Audience:   "https://test",
+			}, tcase.cookie, "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := gin.New()
+			r.LoadHTMLFiles("../../templates/auth/oauth_consent.tmpl")
+			r.GET("/oauth/authorize", oauthAPI.New(nil, a, nil).AuthorizeView)
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/oauth/authorize", nil))
+			if w.Code != tcase.want {
+				t.Errorf("got %d, expected %d", w.Code, tcase.want)
+			}
+			if w.Header().Get("X-Frame-Options") != "DENY" || w.Header().Get("Content-Security-Policy") != "frame-ancestors 'none'" {
+				t.Errorf("framing is not denied")
+			}
+		})
+	}
+}
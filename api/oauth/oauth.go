@@ -0,0 +1,212 @@
+package oauthAPI
+
+// WAS as oauth2 authorization server of third-party apps, authorization code with PKCE
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/auth/scope"
+	baseLogger "github.com/capdale/was/logger"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+)
+
+var logger = baseLogger.Logger
+
+const maxRedirectURIs = 10
+
+type database interface {
+	CreateOAuthClient(claimer *claimer.Claimer, client *model.OAuthClient) error
+	GetOAuthClient(clientId string) (*model.OAuthClient, error)
+	GetOAuthClients(claimer *claimer.Claimer) (*[]*model.OAuthClientAPI, error)
+	DeleteOAuthClient(claimer *claimer.Claimer, clientId string) error
+	SaveOAuthGrant(claimer *claimer.Claimer, oauthClientId uint64, scopes string) error
+	GetOAuthGrants(claimer *claimer.Claimer) (*[]*model.OAuthGrantAPI, error)
+	DeleteOAuthGrant(claimer *claimer.Claimer, clientId string) error
+}
+
+type state interface {
+	SetAuthorizationCode(code string, data []byte, expired time.Duration) error
+	PopAuthorizationCode(code string) ([]byte, error)
+}
+
+type OAuthAPI struct {
+	DB    database
+	Auth  *auth.Auth
+	State state
+}
+
+func New(d database, auth *auth.Auth, state state) *OAuthAPI {
+	return &OAuthAPI{
+		DB:    d,
+		Auth:  auth,
+		State: state,
+	}
+}
+
+func randString(size int) (string, error) {
+	randBytes, err := auth.RandToken(size)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(*randBytes), nil
+}
+
+// https, or custom scheme of native app, plain http only for loopback (RFC 8252)
+func isValidRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Scheme == "" || u.Fragment != "" {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		return u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1"
+	case "javascript", "data", "file":
+		return false
+	}
+	return true
+}
+
+func isValidScopes(scopes []string) bool {
+	if len(scopes) == 0 {
+		return false
+	}
+	for _, s := range scopes {
+		if !scope.IsValid(s) {
+			return false
+		}
+	}
+	return true
+}
+
+type createClientForm struct {
+	Name         string   `json:"name" binding:"required,max=64"`
+	RedirectURIs []string `json:"redirect_uris" binding:"required,min=1"`
+	Scopes       []string `json:"scopes" binding:"required,min=1"`
+	Confidential bool     `json:"confidential"` // server side app keeps secret, public app uses PKCE only
+}
+
+// client secret is returned only once
+func (o *OAuthAPI) CreateClientHandler(ctx *gin.Context) {
+	form := &createClientForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+	if len(form.RedirectURIs) > maxRedirectURIs || slices.ContainsFunc(form.RedirectURIs, func(uri string) bool { return !isValidRedirectURI(uri) }) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid redirect uri"})
+		return
+	}
+	if !isValidScopes(form.Scopes) {
+		ctx.JSON(http.StatusBadRequest, gin.H{"message": "invalid scope"})
+		return
+	}
+
+	clientId, err := randString(16)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "generate random token", err)
+		return
+	}
+	client := &model.OAuthClient{
+		ClientId:     clientId,
+		Name:         form.Name,
+		RedirectURIs: strings.Join(form.RedirectURIs, " "),
+		Scopes:       scope.Join(form.Scopes),
+	}
+	response := gin.H{"client_id": clientId}
+	if form.Confidential {
+		secret, err := randString(32)
+		if err != nil {
+			api.BasicInternalServerError(ctx)
+			logger.ErrorWithCTX(ctx, "generate random token", err)
+			return
+		}
+		client.HashedSecret = auth.HashClientSecret(secret)
+		response["client_secret"] = secret
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	if err := o.DB.CreateOAuthClient(claimer, client); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "create oauth client", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+func (o *OAuthAPI) GetClientsHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	clients, err := o.DB.GetOAuthClients(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get oauth clients", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"clients": clients,
+	})
+}
+
+type clientUri struct {
+	ClientId string `uri:"client_id" binding:"required,max=64"`
+}
+
+func (o *OAuthAPI) DeleteClientHandler(ctx *gin.Context) {
+	uri := &clientUri{}
+	if err := ctx.BindUri(uri); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "bind uri", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	if err := o.DB.DeleteOAuthClient(claimer, uri.ClientId); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "client not found"})
+		logger.ErrorWithCTX(ctx, "delete oauth client", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
+
+// apps user granted access to
+func (o *OAuthAPI) GetGrantsHandler(ctx *gin.Context) {
+	claimer := api.MustGetClaimer(ctx)
+	grants, err := o.DB.GetOAuthGrants(claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "get oauth grants", err)
+		return
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"apps": grants,
+	})
+}
+
+func (o *OAuthAPI) DeleteGrantHandler(ctx *gin.Context) {
+	uri := &clientUri{}
+	if err := ctx.BindUri(uri); err != nil {
+		api.BasicBadRequestError(ctx)
+		logger.ErrorWithCTX(ctx, "bind uri", err)
+		return
+	}
+
+	claimer := api.MustGetClaimer(ctx)
+	if err := o.DB.DeleteOAuthGrant(claimer, uri.ClientId); err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"message": "app not found"})
+		logger.ErrorWithCTX(ctx, "delete oauth grant", err)
+		return
+	}
+	ctx.Status(http.StatusAccepted)
+}
@@ -0,0 +1,124 @@
+package oauthAPI
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/capdale/was/api"
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+)
+
+type tokenForm struct {
+	GrantType    string `form:"grant_type" binding:"required"`
+	Code         string `form:"code"`
+	RedirectURI  string `form:"redirect_uri"`
+	CodeVerifier string `form:"code_verifier"`
+	RefreshToken string `form:"refresh_token"`
+	ClientId     string `form:"client_id"`
+	ClientSecret string `form:"client_secret"`
+}
+
+// client authenticate with basic auth or form, public client send client id only
+func (o *OAuthAPI) authenticateClient(ctx *gin.Context, form *tokenForm) (*model.OAuthClient, bool) {
+	clientId, clientSecret := form.ClientId, form.ClientSecret
+	if id, secret, ok := ctx.Request.BasicAuth(); ok {
+		clientId, clientSecret = id, secret
+	}
+	client, err := o.DB.GetOAuthClient(clientId)
+	if err != nil {
+		logger.ErrorWithCTX(ctx, "get oauth client", err)
+		return nil, false
+	}
+	if client.HashedSecret != nil && !auth.VerifyClientSecret(client.HashedSecret, clientSecret) {
+		return nil, false
+	}
+	return client, true
+}
+
+func (o *OAuthAPI) TokenHandler(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	form := &tokenForm{}
+	if err := ctx.ShouldBind(form); err != nil {
+		api.OAuthError(ctx, http.StatusBadRequest, "invalid_request")
+		logger.ErrorWithCTX(ctx, "binding error", err)
+		return
+	}
+
+	client, ok := o.authenticateClient(ctx, form)
+	if !ok {
+		api.OAuthError(ctx, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+
+	var tokens *auth.OAuthTokens
+	switch form.GrantType {
+	case "authorization_code":
+		tokens, ok = o.exchangeCode(ctx, client, form)
+	case "refresh_token":
+		tokens, ok = o.refresh(ctx, client, form)
+	default:
+		api.OAuthError(ctx, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+	if !ok {
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"access_token":  tokens.AccessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(auth.OAuthAccessTokenExpiration.Seconds()),
+		"refresh_token": tokens.RefreshToken,
+		"scope":         tokens.Scopes,
+	})
+}
+
+// code is single use, bound to client, redirect uri and PKCE challenge
+func (o *OAuthAPI) exchangeCode(ctx *gin.Context, client *model.OAuthClient, form *tokenForm) (*auth.OAuthTokens, bool) {
+	data, err := o.State.PopAuthorizationCode(form.Code)
+	if err != nil {
+		api.OAuthError(ctx, http.StatusBadRequest, "invalid_grant")
+		logger.ErrorWithCTX(ctx, "pop authorization code", err)
+		return nil, false
+	}
+	code := &authorizationCode{}
+	if err := json.Unmarshal(data, code); err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "unmarshal authorization code", err)
+		return nil, false
+	}
+	if code.ClientId != client.ClientId ||
+		code.RedirectURI != form.RedirectURI ||
+		!auth.VerifyCodeChallenge(code.CodeChallenge, form.CodeVerifier) {
+		api.OAuthError(ctx, http.StatusBadRequest, "invalid_grant")
+		return nil, false
+	}
+
+	claimer, err := claimer.Parse(code.Claimer)
+	if err != nil {
+		api.BasicInternalServerError(ctx)
+		logger.ErrorWithCTX(ctx, "parse claimer", err)
+		return nil, false
+	}
+	tokens, err := o.Auth.IssueOAuthTokens(&claimer, client.Id, code.Scopes)
+	if err != nil {
+		// grant can be revoked after code issued
+		api.OAuthError(ctx, http.StatusBadRequest, "invalid_grant")
+		logger.ErrorWithCTX(ctx, "issue oauth tokens", err)
+		return nil, false
+	}
+	return tokens, true
+}
+
+func (o *OAuthAPI) refresh(ctx *gin.Context, client *model.OAuthClient, form *tokenForm) (*auth.OAuthTokens, bool) {
+	tokens, err := o.Auth.RefreshOAuthTokens(client.Id, form.RefreshToken)
+	if err != nil {
+		api.OAuthError(ctx, http.StatusBadRequest, "invalid_grant")
+		logger.ErrorWithCTX(ctx, "refresh oauth tokens", err)
+		return nil, false
+	}
+	return tokens, true
+}
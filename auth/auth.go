@@ -3,32 +3,87 @@ package auth
 import (
 	"time"
 
+	"github.com/capdale/was/auth/fingerprint"
+	"github.com/capdale/was/config"
 	"github.com/capdale/was/model"
 	"github.com/capdale/was/types/binaryuuid"
 	"github.com/capdale/was/types/claimer"
 )
 
 type database interface {
-	CreateRefreshToken(claimer claimer.Claimer, tokenUID *binaryuuid.UUID, refreshToken *[]byte, notBefore time.Time, expireAt time.Time, agent *string) error
-	IsTokenPair(claimer claimer.Claimer, tokenExpiredAt time.Time, refreshToken *[]byte) error
-	PopRefreshToken(refreshTokenUID *binaryuuid.UUID) (*model.Token, error)
+	CreateRefreshToken(claimer claimer.Claimer, tokenUID *binaryuuid.UUID, hashedRefreshToken []byte, sessionUID *binaryuuid.UUID, sessionCreatedAt time.Time, notBefore time.Time, expireAt time.Time, agent *string, ip string) error
+	GetUserIdByClaimer(claimer *claimer.Claimer) (uint64, error)
+	GetRefreshToken(hashedRefreshToken []byte) (*model.Token, error)
+	RotateRefreshToken(tokenId uint64) (bool, error)
+	RemoveTokenFamily(userId uint64, sessionUID *binaryuuid.UUID) (*model.Token, error)
+	CreateSecurityEvent(userId uint64, eventType string, sessionUID *binaryuuid.UUID, agent *string) error
+	SaveKnownDevice(claimer *claimer.Claimer, uaFamily string, ipPrefix string, country string) (*model.User, bool, error)
 	GetUserClaimByID(claimerId uint64) (*claimer.Claimer, error)
+	QueryAllTokensByClaimer(claimer *claimer.Claimer) (*[]*model.Token, error)
+	RemoveSession(claimer *claimer.Claimer, sessionUID *binaryuuid.UUID) (*model.Token, error)
+	RemoveOtherSessions(claimer *claimer.Claimer, currentSessionUID *binaryuuid.UUID) (*[]*model.Token, error)
+	GetTokenEpoch(claimer *claimer.Claimer) (uint64, error)
+	IncreaseTokenEpoch(claimer *claimer.Claimer) (uint64, error)
+	CreatePersonalAccessToken(claimer *claimer.Claimer, name string, hashed []byte, scopes string, expiredAt *time.Time) (*model.PersonalAccessTokenAPI, error)
+	UsePersonalAccessToken(hashed []byte) (*claimer.Claimer, string, error)
+	CreateOAuthTokens(claimer *claimer.Claimer, oauthClientId uint64, scopes string, hashedAccess []byte, hashedRefresh []byte, accessExpiredAt time.Time, refreshExpiredAt time.Time) error
+	RotateOAuthRefreshToken(oauthClientId uint64, hashedRefresh []byte, hashedAccess []byte, newHashedRefresh []byte, accessExpiredAt time.Time, refreshExpiredAt time.Time) (string, error)
+	UseOAuthAccessToken(hashed []byte) (*claimer.Claimer, string, error)
+	GetUserRole(claimer *claimer.Claimer) (string, error)
+	SetUserRole(username string, role string) (*claimer.Claimer, error)
 }
 
 type store interface {
 	IsBlacklist(token string) (bool, error)
 	SetBlacklist(token string, expiration time.Duration) error
+	GetTokenEpoch(claimer string) (uint64, bool, error)
+	SetTokenEpoch(claimer string, epoch uint64, expiration time.Duration) error
 }
 
 type Auth struct {
-	DB     database
-	Store  store
-	secret []byte
+	DB         database
+	Store      store
+	keys       *KeySet
+	refreshKey []byte
+	issuer     string
+	audience   string
+	cookie     *config.Cookie
+	geoip      *fingerprint.GeoIP
+	email      emailService
 }
 
-func New(database database, store store) *Auth {
-	return &Auth{
-		DB:    database,
-		Store: store,
+// cookie mode is disabled if cookieConfig is nil, country and location of login are unknown if geoipPath is empty
+func New(database database, store store, keyConfig *config.Key, cookieConfig *config.Cookie, geoipPath string, email emailService) (*Auth, error) {
+	keys, err := NewKeySet(keyConfig)
+	if err != nil {
+		return nil, err
+	}
+	if len(keyConfig.RefreshKey) < minRefreshKeyLength {
+		return nil, ErrWeakRefreshKey
+	}
+	if keyConfig.Issuer == "" || keyConfig.Audience == "" {
+		return nil, ErrNoIssuer
+	}
+	var geoip *fingerprint.GeoIP
+	if geoipPath != "" {
+		geoip, err = fingerprint.OpenGeoIP(geoipPath)
+		if err != nil {
+			return nil, err
+		}
 	}
+	return &Auth{
+		DB:         database,
+		Store:      store,
+		keys:       keys,
+		refreshKey: []byte(keyConfig.RefreshKey),
+		issuer:     keyConfig.Issuer,
+		audience:   keyConfig.Audience,
+		cookie:     cookieConfig,
+		geoip:      geoip,
+		email:      email,
+	}, nil
+}
+
+func (a *Auth) JWKS() *JWKS {
+	return a.keys.JWKS()
 }
@@ -0,0 +1,119 @@
+package auth_test
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/config"
+	"github.com/capdale/was/database"
+	"github.com/capdale/was/test"
+	"github.com/capdale/was/types/claimer"
+	"github.com/gin-gonic/gin"
+)
+
+// in memory store, expiration is ignored
+type memStore struct {
+	mu        sync.Mutex
+	blacklist map[string]bool
+	epochs    map[string]uint64
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		blacklist: map[string]bool{},
+		epochs:    map[string]uint64{},
+	}
+}
+
+func (m *memStore) IsBlacklist(token string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.blacklist[token], nil
+}
+
+func (m *memStore) SetBlacklist(token string, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blacklist[token] = true
+	return nil
+}
+
+func (m *memStore) GetTokenEpoch(claimer string) (uint64, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	epoch, ok := m.epochs[claimer]
+	return epoch, ok, nil
+}
+
+func (m *memStore) SetTokenEpoch(claimer string, epoch uint64, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.epochs[claimer] = epoch
+	return nil
+}
+
+type newDeviceNotifier interface {
+	SendNewDeviceNotice(ctx context.Context, email string, device string) error
+}
+
+// auth with sqlite database and one user
+func newTestAuth(t *testing.T) (*auth.Auth, *database.DB, *claimer.Claimer) {
+	return newTestAuthWithEmail(t, nil)
+}
+
+func newTestAuthWithEmail(t *testing.T, email newDeviceNotifier) (*auth.Auth, *database.DB, *claimer.Claimer) {
+	tmpDir := test.NewTmpDir("was_auth")
+	d, err := database.NewSQLite(&config.SQLite{
+		Path: tmpDir.Join("test.db"),
+	}, math.MaxInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		d.Close()
+		tmpDir.Close()
+	})
+
+	ticket, err := d.CreateTicketByEmail("test@test.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.CreateOriginViaTicket(ticket, "testuser", "Testtest1234!@"); err != nil {
+		t.Fatal(err)
+	}
+	claimer, err := d.GetOriginUserClaim("testuser", "Testtest1234!@")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := auth.New(d, newMemStore(), &config.Key{
+		Jwtkey:     "jwtkey of test, longer than 32 bytes",
+		RefreshKey: "refreshKey of test, longer than 32 bytes",
+		Issuer:     "https://test",
+		Audience:   "https://test",
+	}, nil, "", email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, d, claimer
+}
+
+// status of request to route protected with scopes
+func authorizedStatus(a *auth.Auth, tokenString string, scopes ...string) int {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", a.AuthorizeRequiredMiddleware(scopes...), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+tokenString)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
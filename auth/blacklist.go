@@ -1,41 +1,72 @@
 package auth
 
 import (
-	"encoding/base64"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
+	"time"
+)
 
-	"github.com/google/uuid"
+var (
+	ErrInValidRequest = errors.New("in valid request cannot find token")
+	ErrNotTokenPair   = errors.New("access token and refresh token is not pair")
 )
 
-var ErrInValidRequest = errors.New("in valid request cannot find token")
+func tokenBlacklistKey(jti string) string {
+	return fmt.Sprintf("jti_%s", jti)
+}
 
-func (a *Auth) IsBlacklist(token string) (bool, error) {
-	return a.Store.IsBlacklist(token)
+// access token is blacklisted by jti
+func (a *Auth) IsBlacklist(jti string) (bool, error) {
+	return a.Store.IsBlacklist(tokenBlacklistKey(jti))
 }
 
-func (a *Auth) BlackToken(tokenString *string, refreshTokenString *string) error {
-	claims, err := a.ValidateToken(*tokenString)
+// revoke session of token pair, access tokens of session are blacklisted until expired, refresh token is removed
+func (a *Auth) Logout(tokenString string, refreshTokenString string) error {
+	claims, err := a.ParseTokenIgnoreExpired(&tokenString)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTokenInvalid, err)
+	}
+	refreshTokenUID, refreshTokenBytes, err := parseRefreshToken(refreshTokenString)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotTokenPair, err)
+	}
+	refreshToken, err := a.getRefreshToken(&refreshTokenUID, &refreshTokenBytes)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotTokenPair, err)
+	}
+	userId, err := a.DB.GetUserIdByClaimer(&claims.Claimer)
 	if err != nil {
 		return err
 	}
-	refreshToken, err := base64.StdEncoding.DecodeString(*refreshTokenString)
+	if refreshToken.UserId != userId || refreshToken.SessionUUID != claims.Session {
+		return ErrNotTokenPair
+	}
+
+	liveToken, err := a.DB.RemoveTokenFamily(userId, &refreshToken.SessionUUID)
 	if err != nil {
 		return err
 	}
-	if err := a.DB.IsTokenPair(claims.Claimer, claims.ExpiresAt.Time, &refreshToken); err != nil {
+	// access token issued by other refresh of session is also revoked
+	if err := a.blackSession(liveToken); err != nil {
 		return err
 	}
-	return nil
-}
-
-func (a *Auth) SetBlacklistByUserUUID(userUUID *uuid.UUID) error {
-	return nil
+	if claims.IsExpired() {
+		return nil
+	}
+	return a.Store.SetBlacklist(tokenBlacklistKey(claims.ID), time.Until(claims.ExpiresAt.Time))
 }
 
+// bearer token of header, or access token cookie of cookie mode
 func TokenFromRequest(req *http.Request) (string, error) {
 	authString := req.Header.Get("Authorization")
+	if authString == "" {
+		if cookie, err := req.Cookie(AccessTokenCookie); err == nil && cookie.Value != "" {
+			return cookie.Value, nil
+		}
+		return "", ErrInValidRequest
+	}
 	authStruct := strings.Split(authString, " ")
 	if len(authStruct) != 2 {
 		return "", ErrInValidRequest
@@ -46,3 +77,14 @@ func TokenFromRequest(req *http.Request) (string, error) {
 	}
 	return authParam, nil
 }
+
+func RefreshTokenFromRequest(req *http.Request) (string, error) {
+	refreshToken := req.Header.Get("X-Refresh-Token")
+	if refreshToken == "" {
+		if cookie, err := req.Cookie(RefreshTokenCookie); err == nil && cookie.Value != "" {
+			return cookie.Value, nil
+		}
+		return "", ErrInValidRequest
+	}
+	return refreshToken, nil
+}
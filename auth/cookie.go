@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"   // readable by script, sent back as CSRFTokenHeader
+	CSRFTokenHeader    = "X-CSRF-Token" // double submit of CSRFTokenCookie
+	AuthModeHeader     = "X-Auth-Mode"  // "cookie" to receive tokens as cookie
+	refreshCookiePath  = "/auth"        // refresh token is sent only to auth routes
+	authModeCookie     = "cookie"
+)
+
+var ErrInvalidCSRFToken = errors.New("invalid csrf token")
+
+// cookie mode is enabled by config, pages of server (consent, device approval) need it
+func (a *Auth) IsCookieEnabled() bool {
+	return a.cookie != nil
+}
+
+// cookie mode is requested by web client and enabled by config
+func (a *Auth) IsCookieMode(req *http.Request) bool {
+	return a.cookie != nil && req.Header.Get(AuthModeHeader) == authModeCookie
+}
+
+func (a *Auth) sameSite() http.SameSite {
+	switch strings.ToLower(a.cookie.SameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+func (a *Auth) setCookie(ctx *gin.Context, name string, value string, maxAge int, path string, httpOnly bool) {
+	ctx.SetSameSite(a.sameSite())
+	ctx.SetCookie(name, value, maxAge, path, a.cookie.Domain, !a.cookie.Insecure, httpOnly)
+}
+
+// HttpOnly cookie binding flow to requesting browser, set even if cookie mode is disabled
+func (a *Auth) SetDeviceCookie(ctx *gin.Context, name string, value string, maxAge int, path string) {
+	if a.cookie == nil {
+		ctx.SetSameSite(http.SameSiteLaxMode)
+		ctx.SetCookie(name, value, maxAge, path, "", true, true)
+		return
+	}
+	a.setCookie(ctx, name, value, maxAge, path, true)
+}
+
+// tokens are HttpOnly, csrf token is rotated with tokens
+func (a *Auth) SetTokenCookies(ctx *gin.Context, accessToken string, refreshToken string) error {
+	rand32, err := RandToken(32)
+	if err != nil {
+		return err
+	}
+	csrfToken := base64.RawURLEncoding.EncodeToString(*rand32)
+	a.setCookie(ctx, AccessTokenCookie, accessToken, int(accessTokenExpiration.Seconds()), "/", true)
+	a.setCookie(ctx, RefreshTokenCookie, refreshToken, int(refreshTokenExpiration.Seconds()), refreshCookiePath, true)
+	a.setCookie(ctx, CSRFTokenCookie, csrfToken, int(refreshTokenExpiration.Seconds()), "/", false)
+	return nil
+}
+
+func (a *Auth) ClearTokenCookies(ctx *gin.Context) {
+	if a.cookie == nil {
+		return
+	}
+	a.setCookie(ctx, AccessTokenCookie, "", -1, "/", true)
+	a.setCookie(ctx, RefreshTokenCookie, "", -1, refreshCookiePath, true)
+	a.setCookie(ctx, CSRFTokenCookie, "", -1, "/", false)
+}
+
+// respond issued tokens, tokens are set as cookie in cookie mode instead of body
+func (a *Auth) RespondToken(ctx *gin.Context, body gin.H, accessToken string, refreshToken string) {
+	if a.IsCookieMode(ctx.Request) {
+		if err := a.SetTokenCookies(ctx, accessToken, refreshToken); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"message": "internal server error"})
+			return
+		}
+		ctx.JSON(http.StatusOK, body)
+		return
+	}
+	body["access_token"] = accessToken
+	body["refresh_token"] = refreshToken
+	ctx.JSON(http.StatusOK, body)
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// unsafe request authorized by cookie needs csrf header equal to csrf cookie,
+// request with authorization header is not affected
+func VerifyCSRF(req *http.Request) error {
+	if isSafeMethod(req.Method) || req.Header.Get("Authorization") != "" {
+		return nil
+	}
+	if _, err := req.Cookie(AccessTokenCookie); err != nil {
+		if _, err := req.Cookie(RefreshTokenCookie); err != nil {
+			return nil
+		}
+	}
+	cookie, err := req.Cookie(CSRFTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return ErrInvalidCSRFToken
+	}
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(req.Header.Get(CSRFTokenHeader))) != 1 {
+		return ErrInvalidCSRFToken
+	}
+	return nil
+}
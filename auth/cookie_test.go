@@ -0,0 +1,62 @@
+package auth_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/capdale/was/auth"
+)
+
+func TestVerifyCSRF(t *testing.T) {
+	var cases = []struct {
+		name    string
+		method  string
+		bearer  bool
+		cookie  bool
+		csrf    string
+		invalid bool
+	}{
+		{"safe method", http.MethodGet, false, true, "", false},
+		{"bearer", http.MethodPost, true, true, "", false},
+		{"no cookie", http.MethodPost, false, false, "", false},
+		{"cookie without csrf", http.MethodPost, false, true, "", true},
+		{"cookie with other csrf", http.MethodPost, false, true, "other", true},
+		{"cookie with csrf", http.MethodPost, false, true, "csrf", false},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(tcase.method, "/", nil)
+			if tcase.bearer {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+			if tcase.cookie {
+				req.AddCookie(&http.Cookie{Name: auth.AccessTokenCookie, Value: "token"})
+				req.AddCookie(&http.Cookie{Name: auth.CSRFTokenCookie, Value: "csrf"})
+			}
+			if tcase.csrf != "" {
+				req.Header.Set(auth.CSRFTokenHeader, tcase.csrf)
+			}
+			err := auth.VerifyCSRF(req)
+			if errors.Is(err, auth.ErrInvalidCSRFToken) != tcase.invalid {
+				t.Errorf("got %v, expected invalid %v", err, tcase.invalid)
+			}
+		})
+	}
+}
+
+func TestTokenFromRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: auth.AccessTokenCookie, Value: "cookie"})
+	if token, err := auth.TokenFromRequest(req); err != nil || token != "cookie" {
+		t.Errorf("got %s, %v, expected cookie", token, err)
+	}
+
+	// header is prior to cookie
+	req.Header.Set("Authorization", "Bearer header")
+	if token, err := auth.TokenFromRequest(req); err != nil || token != "header" {
+		t.Errorf("got %s, %v, expected header", token, err)
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/capdale/was/auth/fingerprint"
+	"github.com/capdale/was/logger"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"go.uber.org/zap"
+)
+
+var ErrImpossibleTravel = errors.New("impossible travel, session revoked")
+
+type emailService interface {
+	SendNewDeviceNotice(ctx context.Context, email string, device string) error
+}
+
+const newDeviceNoticeTimeout = time.Second * 30
+
+// alert is best effort, login is not failed or delayed by alert. known device lookup is inline, event and email are sent in background
+func (a *Auth) alertNewDevice(claimer *claimer.Claimer, sessionUID *binaryuuid.UUID, agent *string, ip string) {
+	fp := fingerprint.New(a.geoip, *agent, ip)
+	user, newDevice, err := a.DB.SaveKnownDevice(claimer, fp.UAFamily, fp.IPPrefix, fp.Country)
+	if err != nil {
+		logger.Logger.Error("save known device", zap.Error(err))
+		return
+	}
+	if !newDevice {
+		return
+	}
+
+	session, userAgent := *sessionUID, *agent
+	go func() {
+		if err := a.DB.CreateSecurityEvent(user.Id, model.SecurityEventNewDevice, &session, &userAgent); err != nil {
+			logger.Logger.Error("create new device event", zap.Error(err))
+		}
+		if a.email == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), newDeviceNoticeTimeout)
+		defer cancel()
+		if err := a.email.SendNewDeviceNotice(ctx, user.Email, fp.String()); err != nil {
+			logger.Logger.Error("send new device notice", zap.Error(err))
+		}
+	}()
+}
+
+// session moved from ip of last refresh faster than airliner
+func (a *Auth) isImpossibleTravel(token *model.Token, ip string) bool {
+	if a.geoip == nil || token.IPAddress == "" || token.IPAddress == ip {
+		return false
+	}
+	from := fingerprint.New(a.geoip, token.UserAgent, token.IPAddress)
+	to := fingerprint.New(a.geoip, token.UserAgent, ip)
+	return fingerprint.IsImpossibleTravel(from, to, time.Since(token.CreatedAt))
+}
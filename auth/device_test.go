@@ -0,0 +1,48 @@
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type noticeRecorder struct {
+	devices chan string
+}
+
+func (n *noticeRecorder) SendNewDeviceNotice(ctx context.Context, email string, device string) error {
+	n.devices <- device
+	return nil
+}
+
+func TestNewDeviceNotice(t *testing.T) {
+	recorder := &noticeRecorder{devices: make(chan string, 2)}
+	a, _, claimer := newTestAuthWithEmail(t, recorder)
+
+	chrome := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	firefox := "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+
+	// first device, then same device again
+	for i := 0; i < 2; i++ {
+		if _, _, err := a.IssueToken(*claimer, &chrome, "203.0.113.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := a.IssueToken(*claimer, &firefox, "203.0.113.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case device := <-recorder.devices:
+		if device != "Firefox on Linux" {
+			t.Errorf("got %s, expected Firefox on Linux", device)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("new device notice not sent")
+	}
+	select {
+	case device := <-recorder.devices:
+		t.Errorf("unexpected notice %s", device)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
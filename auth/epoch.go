@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/capdale/was/types/claimer"
+)
+
+const tokenEpochCacheExpiration = time.Hour * 24
+
+// current token epoch of user, cached in store
+func (a *Auth) tokenEpoch(claimer *claimer.Claimer) (uint64, error) {
+	epoch, ok, err := a.Store.GetTokenEpoch(claimer.String())
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return epoch, nil
+	}
+
+	epoch, err = a.DB.GetTokenEpoch(claimer)
+	if err != nil {
+		return 0, err
+	}
+	if err := a.Store.SetTokenEpoch(claimer.String(), epoch, tokenEpochCacheExpiration); err != nil {
+		return 0, err
+	}
+	return epoch, nil
+}
+
+// invalidate every access token and refresh token of user, use when password changed, account compromised etc
+func (a *Auth) RevokeAllTokens(claimer *claimer.Claimer) error {
+	epoch, err := a.DB.IncreaseTokenEpoch(claimer)
+	if err != nil {
+		return err
+	}
+	return a.Store.SetTokenEpoch(claimer.String(), epoch, tokenEpochCacheExpiration)
+}
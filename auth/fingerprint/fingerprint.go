@@ -0,0 +1,165 @@
+package fingerprint
+
+// login fingerprint, compared with known devices of user and previous location of session
+
+import (
+	"math"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+const (
+	maxTravelSpeed    = 1000.0 // km/h, faster than airliner is impossible
+	minTravelDistance = 500.0  // km, geoip is not accurate under this
+	earthRadius       = 6371.0 // km
+)
+
+type Fingerprint struct {
+	UAFamily    string
+	IPPrefix    string
+	Country     string // ISO 3166-1 alpha-2, empty if unknown
+	Latitude    float64
+	Longitude   float64
+	HasLocation bool
+}
+
+// offline geoip database, GeoLite2 City (location) or Country
+type GeoIP struct {
+	reader *geoip2.Reader
+}
+
+func OpenGeoIP(path string) (*GeoIP, error) {
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoIP{reader: reader}, nil
+}
+
+// nil GeoIP is allowed, fingerprint has no country and location then
+func (g *GeoIP) lookup(ip net.IP, fp *Fingerprint) {
+	if g == nil || ip == nil {
+		return
+	}
+	if city, err := g.reader.City(ip); err == nil {
+		fp.Country = city.Country.IsoCode
+		if city.Location.Latitude != 0 || city.Location.Longitude != 0 {
+			fp.Latitude = city.Location.Latitude
+			fp.Longitude = city.Location.Longitude
+			fp.HasLocation = true
+		}
+		return
+	}
+	if country, err := g.reader.Country(ip); err == nil {
+		fp.Country = country.Country.IsoCode
+	}
+}
+
+func New(geoip *GeoIP, userAgent string, ip string) *Fingerprint {
+	fp := &Fingerprint{
+		UAFamily: UAFamily(userAgent),
+		IPPrefix: IPPrefix(ip),
+	}
+	geoip.lookup(net.ParseIP(ip), fp)
+	return fp
+}
+
+// order matters, chrome based browsers contain "Chrome" and chrome contains "Safari"
+var browsers = []struct {
+	token string
+	name  string
+}{
+	{"Edg", "Edge"},
+	{"OPR", "Opera"},
+	{"SamsungBrowser", "Samsung Internet"},
+	{"Firefox", "Firefox"},
+	{"Chrome", "Chrome"},
+	{"CriOS", "Chrome"},
+	{"Safari", "Safari"},
+	{"okhttp", "Android App"},
+	{"Dart", "App"},
+	{"CFNetwork", "iOS App"},
+}
+
+var systems = []struct {
+	token string
+	name  string
+}{
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Windows", "Windows"},
+	{"CrOS", "ChromeOS"},
+	{"Linux", "Linux"},
+}
+
+func findFamily(userAgent string, families []struct {
+	token string
+	name  string
+}) string {
+	for _, family := range families {
+		if strings.Contains(userAgent, family.token) {
+			return family.name
+		}
+	}
+	return "Other"
+}
+
+// browser and os of user agent, version is ignored not to alert on every update
+func UAFamily(userAgent string) string {
+	return findFamily(userAgent, browsers) + " on " + findFamily(userAgent, systems)
+}
+
+// network of ip, /24 for ipv4 and /48 for ipv6
+func IPPrefix(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ""
+	}
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+func radians(degree float64) float64 {
+	return degree * math.Pi / 180
+}
+
+// great circle distance in km
+func Distance(from *Fingerprint, to *Fingerprint) float64 {
+	dLat := radians(to.Latitude - from.Latitude)
+	dLon := radians(to.Longitude - from.Longitude)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(from.Latitude))*math.Cos(radians(to.Latitude))*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(a))
+}
+
+// travel between locations in elapsed time is faster than airliner
+func IsImpossibleTravel(from *Fingerprint, to *Fingerprint, elapsed time.Duration) bool {
+	if !from.HasLocation || !to.HasLocation {
+		return false
+	}
+	distance := Distance(from, to)
+	if distance < minTravelDistance {
+		return false
+	}
+	hours := elapsed.Hours()
+	if hours <= 0 {
+		return true
+	}
+	return distance/hours > maxTravelSpeed
+}
+
+// user readable device, used in alert
+func (f *Fingerprint) String() string {
+	if f.Country == "" {
+		return f.UAFamily
+	}
+	return f.UAFamily + ", " + f.Country
+}
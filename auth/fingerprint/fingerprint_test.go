@@ -0,0 +1,79 @@
+package fingerprint_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/capdale/was/auth/fingerprint"
+)
+
+func TestUAFamily(t *testing.T) {
+	var cases = []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36", "Chrome on Windows"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15", "Safari on macOS"},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.0.0 Mobile/15E148 Safari/604.1", "Chrome on iOS"},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0", "Firefox on Linux"},
+		{"okhttp/4.12.0", "Android App on Other"},
+		{"", "Other on Other"},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.want, func(t *testing.T) {
+			if got := fingerprint.UAFamily(tcase.userAgent); got != tcase.want {
+				t.Errorf("got %s, expected %s", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestIPPrefix(t *testing.T) {
+	var cases = []struct {
+		ip   string
+		want string
+	}{
+		{"203.0.113.57", "203.0.113.0/24"},
+		{"2001:db8:1234:5678::1", "2001:db8:1234::/48"},
+		{"::ffff:203.0.113.57", "203.0.113.0/24"},
+		{"invalid", ""},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.ip, func(t *testing.T) {
+			if got := fingerprint.IPPrefix(tcase.ip); got != tcase.want {
+				t.Errorf("got %s, expected %s", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestIsImpossibleTravel(t *testing.T) {
+	seoul := &fingerprint.Fingerprint{Latitude: 37.5665, Longitude: 126.9780, HasLocation: true}
+	busan := &fingerprint.Fingerprint{Latitude: 35.1796, Longitude: 129.0756, HasLocation: true}
+	london := &fingerprint.Fingerprint{Latitude: 51.5072, Longitude: -0.1276, HasLocation: true}
+	unknown := &fingerprint.Fingerprint{}
+
+	var cases = []struct {
+		name    string
+		from    *fingerprint.Fingerprint
+		to      *fingerprint.Fingerprint
+		elapsed time.Duration
+		want    bool
+	}{
+		{"seoul to london in an hour", seoul, london, time.Hour, true},
+		{"seoul to london in a day", seoul, london, time.Hour * 24, false},
+		{"seoul to busan in a minute, too close", seoul, busan, time.Minute, false},
+		{"unknown location", seoul, unknown, time.Minute, false},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			if got := fingerprint.IsImpossibleTravel(tcase.from, tcase.to, tcase.elapsed); got != tcase.want {
+				t.Errorf("got %v, expected %v", got, tcase.want)
+			}
+		})
+	}
+}
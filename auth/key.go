@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/capdale/was/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown jwt algorithm")
+	ErrNoSigningKey     = errors.New("no signing key")
+	ErrUnknownKid       = errors.New("unknown kid")
+	ErrKeyAlgorithm     = errors.New("key not match with algorithm")
+	ErrWeakJwtKey       = errors.New("jwtkey must be at least 32 bytes")
+)
+
+const minJwtKeyLength = 32 // HS256 key should be as long as hash output
+
+type jwtKey struct {
+	kid        string
+	method     jwt.SigningMethod
+	privateKey interface{}
+	publicKey  interface{}
+}
+
+type KeySet struct {
+	signing *jwtKey
+	keys    []*jwtKey // verification keys in config order
+	verify  map[string]*jwtKey
+}
+
+// if jwt config is not exist, use HS256 with jwtkey
+func NewKeySet(keyConfig *config.Key) (*KeySet, error) {
+	if keyConfig.Jwt == nil {
+		if len(keyConfig.Jwtkey) < minJwtKeyLength {
+			return nil, ErrWeakJwtKey
+		}
+		secret := []byte(keyConfig.Jwtkey)
+		key := &jwtKey{
+			kid:        "",
+			method:     jwt.SigningMethodHS256,
+			privateKey: secret,
+			publicKey:  secret,
+		}
+		return &KeySet{
+			signing: key,
+			keys:    []*jwtKey{key},
+			verify:  map[string]*jwtKey{key.kid: key},
+		}, nil
+	}
+
+	keySet := &KeySet{
+		verify: map[string]*jwtKey{},
+	}
+	for i := range keyConfig.Jwt.Keys {
+		key, err := loadJwtKey(&keyConfig.Jwt.Keys[i])
+		if err != nil {
+			return nil, fmt.Errorf("load key %s: %w", keyConfig.Jwt.Keys[i].Kid, err)
+		}
+		keySet.keys = append(keySet.keys, key)
+		keySet.verify[key.kid] = key
+		if key.kid == keyConfig.Jwt.Signing {
+			keySet.signing = key
+		}
+	}
+	if keySet.signing == nil || keySet.signing.privateKey == nil {
+		return nil, ErrNoSigningKey
+	}
+	return keySet, nil
+}
+
+func loadJwtKey(keyConfig *config.JwtKey) (key *jwtKey, err error) {
+	key = &jwtKey{
+		kid: keyConfig.Kid,
+	}
+	switch keyConfig.Algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		key.method = jwt.SigningMethodRS256
+	case jwt.SigningMethodEdDSA.Alg():
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+
+	if keyConfig.PrivateKey != "" {
+		buf, err := os.ReadFile(keyConfig.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		if key.method == jwt.SigningMethodRS256 {
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(buf)
+			if err != nil {
+				return nil, err
+			}
+			key.privateKey, key.publicKey = privateKey, &privateKey.PublicKey
+		} else {
+			privateKey, err := jwt.ParseEdPrivateKeyFromPEM(buf)
+			if err != nil {
+				return nil, err
+			}
+			key.privateKey, key.publicKey = privateKey, privateKey.(ed25519.PrivateKey).Public()
+		}
+		return key, nil
+	}
+
+	buf, err := os.ReadFile(keyConfig.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if key.method == jwt.SigningMethodRS256 {
+		key.publicKey, err = jwt.ParseRSAPublicKeyFromPEM(buf)
+	} else {
+		key.publicKey, err = jwt.ParseEdPublicKeyFromPEM(buf)
+	}
+	return
+}
+
+func (k *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	if k.signing.kid != "" {
+		token.Header["kid"] = k.signing.kid
+	}
+	return token.SignedString(k.signing.privateKey)
+}
+
+// find verification key by kid, algorithm must match with key
+func (k *KeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := k.verify[kid]
+	if !ok {
+		return nil, ErrUnknownKid
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, ErrKeyAlgorithm
+	}
+	return key.publicKey, nil
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// public verification keys, symmetric key never exposed
+func (k *KeySet) JWKS() *JWKS {
+	jwks := &JWKS{
+		Keys: []*JWK{},
+	}
+	for _, key := range k.keys {
+		jwk := &JWK{
+			Use: "sig",
+			Alg: key.method.Alg(),
+			Kid: key.kid,
+		}
+		switch publicKey := key.publicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		default:
+			continue
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
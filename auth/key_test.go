@@ -0,0 +1,184 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/config"
+	"github.com/capdale/was/test"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writePEM(t *testing.T, path string, blockType string, der []byte) {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// signing ed25519 key "2024-01", retired rsa key "2023-12" kept as verification only
+func newRotatedKeyConfig(t *testing.T) (*config.Key, *rsa.PrivateKey, ed25519.PrivateKey, []byte) {
+	tmpDir := test.NewTmpDir("was_key")
+	t.Cleanup(func() { tmpDir.Close() })
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edDer, err := x509.MarshalPKCS8PrivateKey(edKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, tmpDir.Join("2024-01.pem"), "PRIVATE KEY", edDer)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPubDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, tmpDir.Join("2023-12.pub.pem"), "PUBLIC KEY", rsaPubDer)
+
+	return &config.Key{
+		RefreshKey: "refreshKey of test, longer than 32 bytes",
+		Issuer:     "https://test",
+		Audience:   "https://test",
+		Jwt: &config.Jwt{
+			Signing: "2024-01",
+			Keys: []config.JwtKey{
+				{Kid: "2024-01", Algorithm: "EdDSA", PrivateKey: tmpDir.Join("2024-01.pem")},
+				{Kid: "2023-12", Algorithm: "RS256", PublicKey: tmpDir.Join("2023-12.pub.pem")},
+			},
+		},
+	}, rsaKey, edKey, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPubDer})
+}
+
+func TestNewKeySetJwtKey(t *testing.T) {
+	var cases = []struct {
+		name   string
+		jwtkey string
+		err    error
+	}{
+		{"empty", "", auth.ErrWeakJwtKey},
+		{"short", "jwtkey", auth.ErrWeakJwtKey},
+		{"32 bytes", "0123456789abcdef0123456789abcdef", nil},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, err := auth.NewKeySet(&config.Key{Jwtkey: tcase.jwtkey})
+			if !errors.Is(err, tcase.err) {
+				t.Errorf("got %v, expected %v", err, tcase.err)
+			}
+		})
+	}
+}
+
+func TestNewRefreshKey(t *testing.T) {
+	var cases = []struct {
+		name       string
+		refreshKey string
+		err        error
+	}{
+		{"empty", "", auth.ErrWeakRefreshKey},
+		{"example", "changeme", auth.ErrWeakRefreshKey},
+		{"32 bytes", "0123456789abcdef0123456789abcdef", nil},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, err := auth.New(nil, nil, &config.Key{
+				Jwtkey:     "jwtkey of test, longer than 32 bytes",
+				RefreshKey: tcase.refreshKey,
+				Issuer:     "https://test",
+				Audience:   "https://test",
+			}, nil, "", nil)
+			if !errors.Is(err, tcase.err) {
+				t.Errorf("got %v, expected %v", err, tcase.err)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	keyConfig, rsaKey, edKey, rsaPublicPEM := newRotatedKeyConfig(t)
+	a, err := auth.New(nil, nil, keyConfig, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, &auth.Token{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "https://test",
+				Audience:  jwt.ClaimStrings{"https://test"},
+				ID:        "jti",
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		tokenString, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokenString
+	}
+
+	var cases = []struct {
+		name    string
+		token   string
+		invalid bool
+	}{
+		{"signing kid", sign(jwt.SigningMethodEdDSA, "2024-01", edKey), false},
+		{"retired kid", sign(jwt.SigningMethodRS256, "2023-12", rsaKey), false},
+		{"unknown kid", sign(jwt.SigningMethodRS256, "2022-01", rsaKey), true},
+		{"no kid", sign(jwt.SigningMethodEdDSA, "", edKey), true},
+		{"alg not match with kid", sign(jwt.SigningMethodRS256, "2024-01", rsaKey), true},
+		{"hmac with public key", sign(jwt.SigningMethodHS256, "2023-12", rsaPublicPEM), true},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, err := a.ParseToken(tcase.token)
+			if invalid := err != nil; invalid != tcase.invalid {
+				t.Errorf("got invalid %v (%v), expected %v", invalid, err, tcase.invalid)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	keyConfig, _, _, _ := newRotatedKeyConfig(t)
+	keySet, err := auth.NewKeySet(keyConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := keySet.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("got %d keys, expected 2", len(jwks.Keys))
+	}
+	if jwks.Keys[0].Kid != "2024-01" || jwks.Keys[0].Kty != "OKP" || jwks.Keys[1].Kid != "2023-12" || jwks.Keys[1].Kty != "RSA" {
+		t.Errorf("unexpected keys %+v %+v", jwks.Keys[0], jwks.Keys[1])
+	}
+
+	// symmetric key is never exposed
+	keySet, err = auth.NewKeySet(&config.Key{Jwtkey: "0123456789abcdef0123456789abcdef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keySet.JWKS().Keys) != 0 {
+		t.Errorf("got %d keys, expected 0", len(keySet.JWKS().Keys))
+	}
+}
@@ -3,10 +3,15 @@ package auth
 import (
 	"net/http"
 
+	"github.com/capdale/was/auth/scope"
+
 	"github.com/gin-gonic/gin"
 )
 
-func (a *Auth) AuthorizeRequiredMiddleware() gin.HandlerFunc {
+// authorize access token or personal access token, personal access token needs every scope
+// access token is bearer header or cookie, cookie needs csrf token on unsafe method
+// route without scopes is not allowed to personal access token
+func (a *Auth) AuthorizeRequiredMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		tokenString, err := TokenFromRequest(ctx.Request)
 		if err != nil {
@@ -15,6 +20,31 @@ func (a *Auth) AuthorizeRequiredMiddleware() gin.HandlerFunc {
 			})
 			return
 		}
+		if err := VerifyCSRF(ctx.Request); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"message": "invalid csrf token",
+			})
+			return
+		}
+
+		if IsScopedToken(tokenString) {
+			claimer, granted, err := a.ValidateScopedToken(tokenString)
+			if err != nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"message": "invalid token",
+				})
+				return
+			}
+			if len(scopes) == 0 || !scope.HasAll(granted, scopes) {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"message": "insufficient scope",
+				})
+				return
+			}
+			ctx.Set("claimer", claimer)
+			ctx.Next()
+			return
+		}
 
 		claims, err := a.ValidateToken(tokenString)
 		if err != nil {
@@ -25,17 +55,42 @@ func (a *Auth) AuthorizeRequiredMiddleware() gin.HandlerFunc {
 		}
 
 		ctx.Set("claimer", &claims.Claimer)
+		ctx.Set("session", &claims.Session)
+		ctx.Set("role", claims.Role)
 		ctx.Next()
 	}
 }
 
-func (a *Auth) AuthorizeOptionalMiddleware() gin.HandlerFunc {
+func (a *Auth) AuthorizeOptionalMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		tokenString, err := TokenFromRequest(ctx.Request)
 		if err != nil || tokenString == "" {
 			ctx.Next()
 			return
 		}
+		if err := VerifyCSRF(ctx.Request); err != nil {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"message": "invalid csrf token",
+			})
+			return
+		}
+
+		if IsScopedToken(tokenString) {
+			claimer, granted, err := a.ValidateScopedToken(tokenString)
+			if err != nil {
+				ctx.Next() // consider
+				return
+			}
+			if len(scopes) == 0 || !scope.HasAll(granted, scopes) {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"message": "insufficient scope",
+				})
+				return
+			}
+			ctx.Set("claimer", claimer)
+			ctx.Next()
+			return
+		}
 
 		claims, err := a.ValidateToken(tokenString)
 		if err != nil {
@@ -44,6 +99,8 @@ func (a *Auth) AuthorizeOptionalMiddleware() gin.HandlerFunc {
 		}
 
 		ctx.Set("claimer", &claims.Claimer)
+		ctx.Set("session", &claims.Session)
+		ctx.Set("role", claims.Role)
 		ctx.Next()
 	}
 }
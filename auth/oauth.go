@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/capdale/was/types/claimer"
+	"golang.org/x/oauth2"
+)
+
+// tokens issued to third-party app are opaque and scoped like personal access token
+const (
+	OAuthAccessTokenPrefix      = "woat_"
+	OAuthRefreshTokenPrefix     = "wort_"
+	OAuthAccessTokenExpiration  = time.Hour
+	oauthRefreshTokenExpiration = time.Hour * 24 * 30
+)
+
+type OAuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	Scopes       string
+}
+
+func IsOAuthAccessToken(tokenString string) bool {
+	return strings.HasPrefix(tokenString, OAuthAccessTokenPrefix)
+}
+
+// scoped token is personal access token or oauth access token, required scopes are checked by middleware
+func IsScopedToken(tokenString string) bool {
+	return IsPersonalAccessToken(tokenString) || IsOAuthAccessToken(tokenString)
+}
+
+// return owner and space separated scopes
+func (a *Auth) ValidateScopedToken(tokenString string) (*claimer.Claimer, string, error) {
+	if IsOAuthAccessToken(tokenString) {
+		return a.DB.UseOAuthAccessToken(hashOpaqueToken(tokenString))
+	}
+	return a.ValidatePersonalAccessToken(tokenString)
+}
+
+func newOAuthTokenPair() (accessToken string, refreshToken string, err error) {
+	access, err := RandToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	refresh, err := RandToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	accessToken = OAuthAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(*access)
+	refreshToken = OAuthRefreshTokenPrefix + base64.RawURLEncoding.EncodeToString(*refresh)
+	return accessToken, refreshToken, nil
+}
+
+// issue tokens under grant of user to client, scopes are checked by caller
+func (a *Auth) IssueOAuthTokens(claimer *claimer.Claimer, oauthClientId uint64, scopes string) (*OAuthTokens, error) {
+	accessToken, refreshToken, err := newOAuthTokenPair()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := a.DB.CreateOAuthTokens(claimer, oauthClientId, scopes, hashOpaqueToken(accessToken), hashOpaqueToken(refreshToken), now.Add(OAuthAccessTokenExpiration), now.Add(oauthRefreshTokenExpiration)); err != nil {
+		return nil, err
+	}
+	return &OAuthTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		Scopes:       scopes,
+	}, nil
+}
+
+// refresh token is rotated, previous one cannot be used again
+func (a *Auth) RefreshOAuthTokens(oauthClientId uint64, refreshToken string) (*OAuthTokens, error) {
+	newAccessToken, newRefreshToken, err := newOAuthTokenPair()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	scopes, err := a.DB.RotateOAuthRefreshToken(oauthClientId, hashOpaqueToken(refreshToken), hashOpaqueToken(newAccessToken), hashOpaqueToken(newRefreshToken), now.Add(OAuthAccessTokenExpiration), now.Add(oauthRefreshTokenExpiration))
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthTokens{
+		AccessToken:  newAccessToken,
+		RefreshToken: newRefreshToken,
+		Scopes:       scopes,
+	}, nil
+}
+
+// client secret is verified with stored hash, public client has no secret
+func VerifyClientSecret(hashedSecret []byte, secret string) bool {
+	return subtle.ConstantTimeCompare(hashedSecret, hashOpaqueToken(secret)) == 1
+}
+
+func HashClientSecret(secret string) []byte {
+	return hashOpaqueToken(secret)
+}
+
+// PKCE S256, RFC 7636
+func VerifyCodeChallenge(challenge string, verifier string) bool {
+	verified := oauth2.S256ChallengeFromVerifier(verifier)
+	return subtle.ConstantTimeCompare([]byte(verified), []byte(challenge)) == 1
+}
@@ -0,0 +1,83 @@
+package auth_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/model"
+)
+
+// RFC 7636 appendix B
+func TestVerifyCodeChallenge(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !auth.VerifyCodeChallenge(challenge, verifier) {
+		t.Errorf("expected valid verifier")
+	}
+	if auth.VerifyCodeChallenge(challenge, verifier+"x") {
+		t.Errorf("expected invalid verifier")
+	}
+}
+
+func TestIsScopedToken(t *testing.T) {
+	var cases = []struct {
+		token string
+		want  bool
+	}{
+		{auth.PersonalAccessTokenPrefix + "token", true},
+		{auth.OAuthAccessTokenPrefix + "token", true},
+		{auth.OAuthRefreshTokenPrefix + "token", false},
+		{"eyJhbGciOiJSUzI1NiJ9.e30.sig", false},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.token, func(t *testing.T) {
+			if got := auth.IsScopedToken(tcase.token); got != tcase.want {
+				t.Errorf("got %v, expected %v", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestOAuthTokensRevokedWithAllTokens(t *testing.T) {
+	a, d, claimer := newTestAuth(t)
+
+	client := &model.OAuthClient{
+		ClientId:     "client",
+		Name:         "app",
+		RedirectURIs: "https://app.test/callback",
+		Scopes:       "collection:read",
+	}
+	if err := d.CreateOAuthClient(claimer, client); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.SaveOAuthGrant(claimer, client.Id, "collection:read"); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := a.IssueOAuthTokens(claimer, client.Id, "collection:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := authorizedStatus(a, tokens.AccessToken, "collection:read"); status != http.StatusOK {
+		t.Fatalf("got %d, expected %d", status, http.StatusOK)
+	}
+
+	if err := a.RevokeAllTokens(claimer); err != nil {
+		t.Fatal(err)
+	}
+	if status := authorizedStatus(a, tokens.AccessToken, "collection:read"); status != http.StatusUnauthorized {
+		t.Errorf("got %d, expected %d", status, http.StatusUnauthorized)
+	}
+	if _, err := a.RefreshOAuthTokens(client.Id, tokens.RefreshToken); err == nil {
+		t.Errorf("expected refresh token revoked")
+	}
+	grants, err := d.GetOAuthGrants(claimer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*grants) != 0 {
+		t.Errorf("got %d grants, expected 0", len(*grants))
+	}
+}
@@ -0,0 +1,140 @@
+package passhash
+
+// versioned password hash, new hash is argon2id in PHC string format, legacy bcrypt hash is still verified
+//
+//	$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+//	$2a$10$<salt and key>
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	saltLength = 16
+	keyLength  = 32
+
+	// floor of configured params, memory is OWASP minimum
+	minMemory     = 19 * 1024 // KiB
+	minIterations = 1
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown password hash format")
+	ErrInvalidHash   = errors.New("invalid password hash")
+	ErrWeakParams    = errors.New("argon2 params too weak")
+)
+
+var argon2idPrefix = []byte("$argon2id$")
+
+type Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// OWASP recommendation, about 50ms on server
+var DefaultParams = &Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+}
+
+// params of config, parallelism 0 panics in argon2
+func (p *Params) Validate() error {
+	if p.Memory < minMemory {
+		return fmt.Errorf("%w: memory must be at least %d KiB", ErrWeakParams, minMemory)
+	}
+	if p.Iterations < minIterations {
+		return fmt.Errorf("%w: iterations must be at least %d", ErrWeakParams, minIterations)
+	}
+	if p.Parallelism < 1 {
+		return fmt.Errorf("%w: parallelism must be at least 1", ErrWeakParams)
+	}
+	return nil
+}
+
+type Hasher struct {
+	params *Params
+}
+
+func New(params *Params) *Hasher {
+	if params == nil {
+		params = DefaultParams
+	}
+	return &Hasher{params: params}
+}
+
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, keyLength)
+	return []byte(fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.params.Memory,
+		h.params.Iterations,
+		h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)), nil
+}
+
+// return whether password match, and whether hash should be replaced with current params (legacy format or outdated params)
+func (h *Hasher) Verify(hashed []byte, password string) (match bool, rehash bool, err error) {
+	if bytes.HasPrefix(hashed, argon2idPrefix) {
+		return h.verifyArgon2id(hashed, password)
+	}
+	if _, err := bcrypt.Cost(hashed); err != nil {
+		return false, false, ErrUnknownFormat
+	}
+	if err := bcrypt.CompareHashAndPassword(hashed, []byte(password)); err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	return true, true, nil
+}
+
+func (h *Hasher) verifyArgon2id(hashed []byte, password string) (bool, bool, error) {
+	// "", "argon2id", "v=19", "m=65536,t=3,p=2", salt, key
+	parts := strings.Split(string(hashed), "$")
+	if len(parts) != 6 {
+		return false, false, ErrInvalidHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return false, false, ErrInvalidHash
+	}
+	if version != argon2.Version {
+		return false, false, ErrInvalidHash
+	}
+	params := &Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return false, false, ErrInvalidHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false, ErrInvalidHash
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+	return true, *params != *h.params, nil
+}
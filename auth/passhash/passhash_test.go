@@ -0,0 +1,95 @@
+package passhash_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/capdale/was/auth/passhash"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// small params for fast test
+var testParams = &passhash.Params{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+}
+
+func TestArgon2id(t *testing.T) {
+	hasher := passhash.New(testParams)
+	hashed, err := hasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, rehash, err := hasher.Verify(hashed, "password")
+	if err != nil || !match || rehash {
+		t.Errorf("expected match without rehash, got %v %v %v", match, rehash, err)
+	}
+
+	match, _, err = hasher.Verify(hashed, "wrong password")
+	if err != nil || match {
+		t.Errorf("expected mismatch, got %v %v", match, err)
+	}
+
+	// cost raised
+	stronger := passhash.New(&passhash.Params{Memory: 2048, Iterations: 2, Parallelism: 1})
+	match, rehash, err = stronger.Verify(hashed, "password")
+	if err != nil || !match || !rehash {
+		t.Errorf("expected match with rehash, got %v %v %v", match, rehash, err)
+	}
+}
+
+func TestLegacyBcrypt(t *testing.T) {
+	hasher := passhash.New(testParams)
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, rehash, err := hasher.Verify(hashed, "password")
+	if err != nil || !match || !rehash {
+		t.Errorf("expected match with rehash, got %v %v %v", match, rehash, err)
+	}
+
+	match, rehash, err = hasher.Verify(hashed, "wrong password")
+	if err != nil || match || rehash {
+		t.Errorf("expected mismatch, got %v %v %v", match, rehash, err)
+	}
+}
+
+func TestInvalidHash(t *testing.T) {
+	hasher := passhash.New(testParams)
+	if _, _, err := hasher.Verify([]byte("plain"), "plain"); err != passhash.ErrUnknownFormat {
+		t.Errorf("expected unknown format, got %v", err)
+	}
+	if _, _, err := hasher.Verify([]byte("$argon2id$v=19$broken"), "password"); err != passhash.ErrInvalidHash {
+		t.Errorf("expected invalid hash, got %v", err)
+	}
+}
+
+func TestParamsValidate(t *testing.T) {
+	var cases = []struct {
+		name   string
+		params *passhash.Params
+		valid  bool
+	}{
+		{"default", passhash.DefaultParams, true},
+		{"minimum", &passhash.Params{Memory: 19 * 1024, Iterations: 1, Parallelism: 1}, true},
+		{"low memory", &passhash.Params{Memory: 1024, Iterations: 3, Parallelism: 2}, false},
+		{"zero iterations", &passhash.Params{Memory: 64 * 1024, Iterations: 0, Parallelism: 2}, false},
+		{"zero parallelism", &passhash.Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 0}, false},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			err := tcase.params.Validate()
+			if tcase.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			}
+			if !tcase.valid && !errors.Is(err, passhash.ErrWeakParams) {
+				t.Errorf("expected ErrWeakParams, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/capdale/was/auth/scope"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+)
+
+// personal access token is opaque, distinguished from jwt by prefix
+const PersonalAccessTokenPrefix = "wpat_"
+
+var ErrInvalidScope = errors.New("invalid scope")
+
+func IsPersonalAccessToken(tokenString string) bool {
+	return strings.HasPrefix(tokenString, PersonalAccessTokenPrefix)
+}
+
+// personal access token and oauth token are stored as hash
+func hashOpaqueToken(tokenString string) []byte {
+	hashed := sha256.Sum256([]byte(tokenString))
+	return hashed[:]
+}
+
+// token is returned only once, only hash is stored
+func (a *Auth) IssuePersonalAccessToken(claimer *claimer.Claimer, name string, scopes []string, expiredAt *time.Time) (string, *model.PersonalAccessTokenAPI, error) {
+	if len(scopes) == 0 {
+		return "", nil, ErrInvalidScope
+	}
+	for _, s := range scopes {
+		if !scope.IsValid(s) {
+			return "", nil, ErrInvalidScope
+		}
+	}
+
+	rand32, err := RandToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	tokenString := PersonalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(*rand32)
+	token, err := a.DB.CreatePersonalAccessToken(claimer, name, hashOpaqueToken(tokenString), scope.Join(scopes), expiredAt)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, token, nil
+}
+
+// return owner and space separated scopes
+func (a *Auth) ValidatePersonalAccessToken(tokenString string) (*claimer.Claimer, string, error) {
+	return a.DB.UsePersonalAccessToken(hashOpaqueToken(tokenString))
+}
@@ -0,0 +1,26 @@
+package auth_test
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPersonalAccessTokenRevokedWithAllTokens(t *testing.T) {
+	a, _, claimer := newTestAuth(t)
+
+	tokenString, _, err := a.IssuePersonalAccessToken(claimer, "script", []string{"collection:write"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := authorizedStatus(a, tokenString, "collection:write"); status != http.StatusOK {
+		t.Fatalf("got %d, expected %d", status, http.StatusOK)
+	}
+
+	// password reset, logout all, role change
+	if err := a.RevokeAllTokens(claimer); err != nil {
+		t.Fatal(err)
+	}
+	if status := authorizedStatus(a, tokenString, "collection:write"); status != http.StatusUnauthorized {
+		t.Errorf("got %d, expected %d", status, http.StatusUnauthorized)
+	}
+}
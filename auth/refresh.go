@@ -1,9 +1,17 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+
 	"github.com/capdale/was/types/binaryuuid"
 )
 
+var ErrWeakRefreshKey = errors.New("refreshKey must be at least 32 bytes")
+
+const minRefreshKeyLength = 32 // HMAC-SHA256 key should be as long as hash output
+
 // generate token uid and refresh random token
 func (a *Auth) generateRefreshToken() (*binaryuuid.UUID, *[]byte, error) {
 	randomUUID, err := binaryuuid.NewRandom()
@@ -16,3 +24,10 @@ func (a *Auth) generateRefreshToken() (*binaryuuid.UUID, *[]byte, error) {
 	}
 	return &randomUUID, randBytes, nil
 }
+
+// keyed digest is stored instead of token, deterministic so indexed lookup works, leaked db cannot forge token without key
+func (a *Auth) hashRefreshToken(refreshToken []byte) []byte {
+	mac := hmac.New(sha256.New, a.refreshKey)
+	mac.Write(refreshToken)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// use after AuthorizeRequiredMiddleware, role is only in access token, personal access token has no role
+func (a *Auth) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		role := ctx.GetString("role")
+		for _, r := range roles {
+			if role != "" && role == r {
+				ctx.Next()
+				return
+			}
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"message": "access denied",
+		})
+	}
+}
+
+// change role of user, tokens issued with previous role are revoked
+func (a *Auth) SetUserRole(username string, role string) error {
+	claimer, err := a.DB.SetUserRole(username, role)
+	if err != nil {
+		return err
+	}
+	return a.RevokeAllTokens(claimer)
+}
@@ -0,0 +1,57 @@
+package scope
+
+// scopes of personal access token and oauth client, access token of login has every scope
+
+import "strings"
+
+const (
+	CollectionRead  = "collection:read"
+	CollectionWrite = "collection:write"
+	ArticleRead     = "article:read"
+	ArticleWrite    = "article:write"
+	SocialRead      = "social:read"
+	SocialWrite     = "social:write"
+	UserRead        = "user:read"
+	UserWrite       = "user:write"
+	ReportWrite     = "report:write"
+)
+
+var scopes = map[string]struct{}{
+	CollectionRead:  {},
+	CollectionWrite: {},
+	ArticleRead:     {},
+	ArticleWrite:    {},
+	SocialRead:      {},
+	SocialWrite:     {},
+	UserRead:        {},
+	UserWrite:       {},
+	ReportWrite:     {},
+}
+
+func IsValid(scope string) bool {
+	_, ok := scopes[scope]
+	return ok
+}
+
+// space separated scopes
+func Join(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// every required scope is in granted, granted is space separated
+func HasAll(granted string, required []string) bool {
+	grantedScopes := strings.Fields(granted)
+	for _, r := range required {
+		found := false
+		for _, g := range grantedScopes {
+			if g == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+package scope_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/capdale/was/auth/scope"
+)
+
+func TestHasAll(t *testing.T) {
+	var cases = []struct {
+		granted  string
+		required []string
+		want     bool
+	}{
+		{"collection:write", []string{scope.CollectionWrite}, true},
+		{"collection:read article:read", []string{scope.ArticleRead}, true},
+		{"collection:read article:read", []string{scope.CollectionRead, scope.ArticleRead}, true},
+		{"collection:read", []string{scope.CollectionWrite}, false},
+		{"collection:read", []string{scope.CollectionRead, scope.ArticleRead}, false},
+		{"", []string{scope.CollectionRead}, false},
+	}
+
+	for _, tcase := range cases {
+		testname := fmt.Sprintf("%s, %v", tcase.granted, tcase.required)
+		t.Run(testname, func(t *testing.T) {
+			if got := scope.HasAll(tcase.granted, tcase.required); got != tcase.want {
+				t.Errorf("got %v, expected %v", got, tcase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+)
+
+func sessionBlacklistKey(sessionUID *binaryuuid.UUID) string {
+	return fmt.Sprintf("session_%s", sessionUID.String())
+}
+
+func (a *Auth) IsSessionBlacklist(sessionUID *binaryuuid.UUID) (bool, error) {
+	return a.Store.IsBlacklist(sessionBlacklistKey(sessionUID))
+}
+
+// blacklist outstanding access token of session, access token expired at token.NotBefore
+func (a *Auth) blackSession(token *model.Token) error {
+	expiration := time.Until(token.NotBefore)
+	if expiration <= 0 {
+		return nil
+	}
+	return a.Store.SetBlacklist(sessionBlacklistKey(&token.SessionUUID), expiration)
+}
+
+func (a *Auth) Sessions(claimer *claimer.Claimer, currentSessionUID *binaryuuid.UUID) (*[]*model.SessionAPI, error) {
+	tokens, err := a.DB.QueryAllTokensByClaimer(claimer)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*model.SessionAPI, len(*tokens))
+	for i, token := range *tokens {
+		sessions[i] = &model.SessionAPI{
+			UUID:          token.SessionUUID,
+			UserAgent:     token.UserAgent,
+			CreatedAt:     token.SessionCreatedAt,
+			LastRefreshAt: token.CreatedAt,
+			Current:       token.SessionUUID == *currentSessionUID,
+		}
+	}
+	return &sessions, nil
+}
+
+func (a *Auth) RevokeSession(claimer *claimer.Claimer, sessionUID *binaryuuid.UUID) error {
+	token, err := a.DB.RemoveSession(claimer, sessionUID)
+	if err != nil {
+		return err
+	}
+	return a.blackSession(token)
+}
+
+func (a *Auth) RevokeOtherSessions(claimer *claimer.Claimer, currentSessionUID *binaryuuid.UUID) error {
+	tokens, err := a.DB.RemoveOtherSessions(claimer, currentSessionUID)
+	if err != nil {
+		return err
+	}
+	for _, token := range *tokens {
+		if err := a.blackSession(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
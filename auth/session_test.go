@@ -0,0 +1,40 @@
+package auth_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/capdale/was/model"
+)
+
+func TestLogoutRevokesSession(t *testing.T) {
+	a, d, claimer := newTestAuth(t)
+	agent := "Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0"
+
+	oldToken, refreshToken, err := a.IssueToken(*claimer, &agent, "203.0.113.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// refresh before previous access token is expired
+	if err := d.DB.Model(&model.Token{}).Where("1 = 1").Update("not_before", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	tokenString, refreshToken, err := a.RefreshToken(refreshToken, &agent, "203.0.113.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := authorizedStatus(a, oldToken); status != http.StatusOK {
+		t.Fatalf("got %d, expected %d", status, http.StatusOK)
+	}
+
+	if err := a.Logout(tokenString, refreshToken); err != nil {
+		t.Fatal(err)
+	}
+	// access token of previous refresh is also revoked
+	for _, token := range []string{tokenString, oldToken} {
+		if status := authorizedStatus(a, token); status != http.StatusUnauthorized {
+			t.Errorf("got %d, expected %d", status, http.StatusUnauthorized)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto/hmac"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -11,11 +13,19 @@ import (
 	"github.com/capdale/was/types/binaryuuid"
 	"github.com/capdale/was/types/claimer"
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	accessTokenExpiration  = time.Minute * 30
+	refreshTokenExpiration = time.Hour * 24 * 7
+	clockSkew              = time.Second * 30 // allowed clock difference of exp, iat
 )
 
 type Token struct {
 	Claimer claimer.Claimer `json:"user"`
+	Session binaryuuid.UUID `json:"sid"`
+	Epoch   uint64          `json:"epc"`
+	Role    string          `json:"rol,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -24,16 +34,34 @@ var (
 	ErrTypeParse          = errors.New("fail parse custom claim")
 	ErrTokenBlacklist     = errors.New("token is blacklist")
 	ErrTokenNotExpiredYet = errors.New("token not expired yet")
+	ErrRefreshTokenReused = errors.New("refresh token reused, token family revoked")
+	ErrTokenEpoch         = errors.New("token epoch is outdated")
+	ErrNoIssuer           = errors.New("no issuer or audience")
 )
 
 func (a *Token) IsExpired() bool {
 	return a.ExpiresAt.Time.Before(time.Now())
 }
 
-func (a *Auth) IssueToken(claimer claimer.Claimer, agent *string) (tokenString string, refreshTokenString string, err error) {
+func (a *Auth) IssueToken(claimer claimer.Claimer, agent *string, ip string) (tokenString string, refreshTokenString string, err error) {
+	// new login, new session
+	sessionUID, err := binaryuuid.NewRandom()
+	if err != nil {
+		return
+	}
+	tokenString, refreshTokenString, err = a.issueToken(claimer, &sessionUID, time.Now(), agent, ip)
+	if err != nil {
+		return
+	}
+	// token is already issued, alert never fails login
+	a.alertNewDevice(&claimer, &sessionUID, agent, ip)
+	return
+}
+
+func (a *Auth) issueToken(claimer claimer.Claimer, sessionUID *binaryuuid.UUID, sessionCreatedAt time.Time, agent *string, ip string) (tokenString string, refreshTokenString string, err error) {
 	// this function manage all secure process, store refresh token in db, validate token etc
-	expireAt := time.Now().Add(time.Minute * 30)
-	claims, err := a.generateClaim(&claimer, expireAt)
+	expireAt := time.Now().Add(accessTokenExpiration)
+	claims, err := a.generateClaim(&claimer, sessionUID, expireAt)
 	if err != nil {
 		return
 	}
@@ -48,8 +76,8 @@ func (a *Auth) IssueToken(claimer claimer.Claimer, agent *string) (tokenString s
 		return
 	}
 
-	refreshTokenExpireAt := time.Now().Add(time.Hour * 24 * 7)
-	if err = a.DB.CreateRefreshToken(claimer, refreshTokenUID, refreshToken, claims.ExpiresAt.Time, refreshTokenExpireAt, agent); err != nil {
+	refreshTokenExpireAt := time.Now().Add(refreshTokenExpiration)
+	if err = a.DB.CreateRefreshToken(claimer, refreshTokenUID, a.hashRefreshToken(*refreshToken), sessionUID, sessionCreatedAt, claims.ExpiresAt.Time, refreshTokenExpireAt, agent, ip); err != nil {
 		return
 	}
 
@@ -59,13 +87,34 @@ func (a *Auth) IssueToken(claimer claimer.Claimer, agent *string) (tokenString s
 	return
 }
 
-func (a *Auth) generateClaim(claimer *claimer.Claimer, expireAt time.Time) (c *Token, err error) {
+func (a *Auth) generateClaim(claimer *claimer.Claimer, sessionUID *binaryuuid.UUID, expireAt time.Time) (c *Token, err error) {
 	if claimer == nil {
 		return
 	}
+	epoch, err := a.tokenEpoch(claimer)
+	if err != nil {
+		return
+	}
+	role, err := a.DB.GetUserRole(claimer)
+	if err != nil {
+		return
+	}
+	// jti identify token in blacklist
+	jti, err := binaryuuid.NewRandom()
+	if err != nil {
+		return
+	}
 	c = &Token{
 		Claimer: *claimer,
+		Session: *sessionUID,
+		Epoch:   epoch,
+		Role:    role,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    a.issuer,
+			Audience:  jwt.ClaimStrings{a.audience},
+			Subject:   claimer.String(),
+			ID:        jti.String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expireAt),
 		},
 	}
@@ -73,17 +122,18 @@ func (a *Auth) generateClaim(claimer *claimer.Claimer, expireAt time.Time) (c *T
 }
 
 func (a *Auth) generateToken(claims *Token) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(a.secret)
-	if err != nil {
-		return "", err
-	}
-	return signedToken[37:], nil
+	return a.keys.sign(claims)
 }
 
 func (a *Auth) ParseToken(tokenString string) (token *Token, err error) {
 	token = &Token{}
-	_, err = jwt.ParseWithClaims("eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9."+tokenString, token, func(t *jwt.Token) (interface{}, error) { return a.secret, nil })
+	_, err = jwt.ParseWithClaims(tokenString, token, a.keys.keyFunc,
+		jwt.WithIssuer(a.issuer),
+		jwt.WithAudience(a.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
 	return
 }
 
@@ -92,21 +142,35 @@ func (a *Auth) ValidateToken(tokenString string) (*Token, error) {
 	if err != nil {
 		return nil, err
 	}
-	isBlacklist, err := a.IsBlacklist(tokenString)
+	isBlacklist, err := a.IsBlacklist(claims.ID)
 	if err != nil {
 		return nil, err
 	}
 	if isBlacklist {
 		return nil, ErrTokenBlacklist
 	}
+	isBlacklist, err = a.IsSessionBlacklist(&claims.Session)
+	if err != nil {
+		return nil, err
+	}
+	if isBlacklist {
+		return nil, ErrTokenBlacklist
+	}
+	epoch, err := a.tokenEpoch(&claims.Claimer)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Epoch < epoch {
+		return nil, ErrTokenEpoch
+	}
 	return claims, nil
 }
 
 func (a *Auth) ParseTokenIgnoreExpired(tokenString *string) (*Token, error) {
 	claims, err := a.ParseToken(*tokenString)
 	if err != nil {
-		if errors.Is(jwt.ErrTokenExpired, err) && !errors.Is(jwt.ErrTokenMalformed, err) {
-			return claims, err
+		if errors.Is(err, jwt.ErrTokenExpired) && !errors.Is(err, jwt.ErrTokenMalformed) {
+			return claims, nil
 		} else {
 			return nil, err
 		}
@@ -114,34 +178,41 @@ func (a *Auth) ParseTokenIgnoreExpired(tokenString *string) (*Token, error) {
 	return claims, err
 }
 
-func (a *Auth) RefreshToken(refreshTokenString string, agent *string) (newTokenString string, newRefreshTokenString string, err error) {
-	parts := strings.Split(refreshTokenString, ".")
-	if len(parts) != 2 {
-		err = ErrTokenInvalid
+func (a *Auth) RefreshToken(refreshTokenString string, agent *string, ip string) (newTokenString string, newRefreshTokenString string, err error) {
+	refreshTokenUID, refreshTokenBytes, err := parseRefreshToken(refreshTokenString)
+	if err != nil {
 		return
 	}
-	refreshTokenUIDBytes, err := base64.URLEncoding.DecodeString(parts[0])
+
+	refreshToken, err := a.getRefreshToken(&refreshTokenUID, &refreshTokenBytes)
 	if err != nil {
 		return
 	}
-	refreshTokenUID, err := binaryuuid.FromBytes(refreshTokenUIDBytes)
-	if err != nil {
+
+	// rotated token presented again, token is stolen or raced, revoke whole family
+	if refreshToken.RotatedAt != nil {
+		err = a.revokeTokenFamily(refreshToken, model.SecurityEventRefreshTokenReuse, agent, ErrRefreshTokenReused)
 		return
 	}
-	refreshTokenBytes, err := base64.URLEncoding.DecodeString(parts[1])
-	if err != nil {
+
+	if err = a.IsRefreshTokenValid(refreshToken); err != nil {
+		// token is not rotated yet, so client can refresh after access token expired
 		return
 	}
 
-	refreshToken, err := a.popRefreshToken(&refreshTokenUID, &refreshTokenBytes)
+	rotated, err := a.DB.RotateRefreshToken(refreshToken.Id)
 	if err != nil {
 		return
 	}
+	if !rotated {
+		// other request rotated this token first
+		err = a.revokeTokenFamily(refreshToken, model.SecurityEventRefreshTokenReuse, agent, ErrRefreshTokenReused)
+		return
+	}
 
-	if err = a.IsRefreshTokenValid(refreshToken); err != nil {
-		// if errors.Is(ErrTokenNotExpiredYet, err) {
-		// SECURITY TODO: if err token not expired yet, then need to expire access token too?
-		// }
+	// token is used from other side of world right after last refresh, stolen
+	if a.isImpossibleTravel(refreshToken, ip) {
+		err = a.revokeTokenFamily(refreshToken, model.SecurityEventImpossibleTravel, agent, ErrImpossibleTravel)
 		return
 	}
 
@@ -150,22 +221,58 @@ func (a *Auth) RefreshToken(refreshTokenString string, agent *string) (newTokenS
 		return
 	}
 
-	newTokenString, newRefreshTokenString, err = a.IssueToken(*claimer, agent)
+	// keep session through refresh
+	newTokenString, newRefreshTokenString, err = a.issueToken(*claimer, &refreshToken.SessionUUID, refreshToken.SessionCreatedAt, agent, ip)
+	return
+}
+
+// refresh token string is base64(token uid).base64(random token)
+func parseRefreshToken(refreshTokenString string) (refreshTokenUID binaryuuid.UUID, refreshToken []byte, err error) {
+	parts := strings.Split(refreshTokenString, ".")
+	if len(parts) != 2 {
+		err = ErrTokenInvalid
+		return
+	}
+	refreshTokenUIDBytes, err := base64.URLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return
+	}
+	refreshTokenUID, err = binaryuuid.FromBytes(refreshTokenUIDBytes)
+	if err != nil {
+		return
+	}
+	refreshToken, err = base64.URLEncoding.DecodeString(parts[1])
 	return
 }
 
-func (a *Auth) popRefreshToken(refreshTokenUID *binaryuuid.UUID, refreshToken *[]byte) (*model.Token, error) {
-	token, err := a.DB.PopRefreshToken(refreshTokenUID)
+func (a *Auth) getRefreshToken(refreshTokenUID *binaryuuid.UUID, refreshToken *[]byte) (*model.Token, error) {
+	hashed := a.hashRefreshToken(*refreshToken)
+	token, err := a.DB.GetRefreshToken(hashed)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = bcrypt.CompareHashAndPassword(token.RefreshToken, *refreshToken); err != nil {
-		return nil, err
+	if !hmac.Equal(token.RefreshToken, hashed) || subtle.ConstantTimeCompare(token.UUID[:], refreshTokenUID[:]) != 1 {
+		return nil, ErrTokenInvalid
 	}
 	return token, nil
 }
 
+// revoke session with security event, return reason on success
+func (a *Auth) revokeTokenFamily(token *model.Token, eventType string, agent *string, reason error) error {
+	liveToken, err := a.DB.RemoveTokenFamily(token.UserId, &token.SessionUUID)
+	if err != nil {
+		return err
+	}
+	if err := a.blackSession(liveToken); err != nil {
+		return err
+	}
+	if err := a.DB.CreateSecurityEvent(token.UserId, eventType, &token.SessionUUID, agent); err != nil {
+		return err
+	}
+	return reason
+}
+
 func (a *Auth) IsRefreshTokenValid(token *model.Token) error {
 	if token.NotBefore.After(time.Now()) { //token is not expired yet
 		return ErrTokenNotExpiredYet
@@ -0,0 +1,60 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/capdale/was/auth"
+	"github.com/capdale/was/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestParseTokenClaims(t *testing.T) {
+	a, err := auth.New(nil, nil, &config.Key{
+		Jwtkey:     "jwtkey of test, longer than 32 bytes",
+		RefreshKey: "refreshKey of test, longer than 32 bytes",
+		Issuer:     "https://production",
+		Audience:   "https://production",
+	}, nil, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	var cases = []struct {
+		name     string
+		issuer   string
+		audience string
+		issuedAt time.Time
+		expireAt time.Time
+		invalid  bool
+	}{
+		{"valid", "https://production", "https://production", now, now.Add(time.Minute), false},
+		{"staging issuer", "https://staging", "https://production", now, now.Add(time.Minute), true},
+		{"staging audience", "https://production", "https://staging", now, now.Add(time.Minute), true},
+		{"expired in clock skew", "https://production", "https://production", now.Add(-time.Minute), now.Add(-time.Second * 10), false},
+		{"expired", "https://production", "https://production", now.Add(-time.Hour), now.Add(-time.Minute), true},
+		{"issued in future", "https://production", "https://production", now.Add(time.Minute * 5), now.Add(time.Hour), true},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &auth.Token{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Issuer:    tcase.issuer,
+					Audience:  jwt.ClaimStrings{tcase.audience},
+					ID:        "jti",
+					IssuedAt:  jwt.NewNumericDate(tcase.issuedAt),
+					ExpiresAt: jwt.NewNumericDate(tcase.expireAt),
+				},
+			}).SignedString([]byte("jwtkey of test, longer than 32 bytes"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = a.ParseToken(tokenString)
+			if invalid := err != nil; invalid != tcase.invalid {
+				t.Errorf("got invalid %v (%v), expected %v", invalid, err, tcase.invalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package totp_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/capdale/was/auth/totp"
+)
+
+// RFC 6238 appendix B, SHA1, last 6 digits
+func TestCode(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	var cases = []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tcase := range cases {
+		testname := fmt.Sprintf("%d, %s", tcase.unix, tcase.want)
+		t.Run(testname, func(t *testing.T) {
+			code := totp.Code(secret, totp.Step(time.Unix(tcase.unix, 0)))
+			if code != tcase.want {
+				t.Errorf("got %s, expected %s", code, tcase.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	step := totp.Step(now)
+
+	var cases = []struct {
+		name  string
+		code  string
+		valid bool
+	}{
+		{"current", totp.Code(secret, step), true},
+		{"previous", totp.Code(secret, step-1), true},
+		{"next", totp.Code(secret, step+1), true},
+		{"too old", totp.Code(secret, step-2), false},
+		{"invalid length", "12345", false},
+	}
+
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, valid := totp.Validate(secret, tcase.code, now)
+			if valid != tcase.valid {
+				t.Errorf("got %v, expected %v", valid, tcase.valid)
+			}
+		})
+	}
+}
@@ -17,21 +17,32 @@ var (
 var ErrInvalidCredForm = errors.New("invalid cred form")
 
 type Config struct {
-	Service  Service  `yaml:"service"`
-	Database Database `yaml:"database"`
-	Redis    Redis    `yaml:"redis"`
-	Rpc      Rpc      `yaml:"rpc"`
-	Key      Key      `yaml:"key"`
-	Oauth    Oauth    `yaml:"oauth"`
-	Storage  Storage  `yaml:"storage"`
-	Email    Email    `yaml:"email"`
+	Service  Service   `yaml:"service"`
+	Database Database  `yaml:"database"`
+	Redis    Redis     `yaml:"redis"`
+	Rpc      Rpc       `yaml:"rpc"`
+	Key      Key       `yaml:"key"`
+	Oauth    Oauth     `yaml:"oauth"`
+	Storage  Storage   `yaml:"storage"`
+	Email    Email     `yaml:"email"`
+	Webauthn *Webauthn `yaml:"webauthn,omitempty"`
 }
 
 type Service struct {
-	TLS     *TLS   `yaml:"tls"`
-	Address string `yaml:"address"`
-	Cors    Cors   `yaml:"cors"`
-	Log     Log    `yaml:"log"`
+	TLS            *TLS    `yaml:"tls"`
+	Address        string  `yaml:"address"`
+	Cors           Cors    `yaml:"cors"`
+	Log            Log     `yaml:"log"`
+	BootstrapAdmin string  `yaml:"bootstrapAdmin"` // username promoted to admin when there is no admin
+	Cookie         *Cookie `yaml:"cookie,omitempty"`
+	GeoIP          string  `yaml:"geoip,omitempty"` // path of GeoLite2 City or Country mmdb, country and location of login are unknown if empty
+}
+
+// cookie session mode for web client, disabled if nil
+type Cookie struct {
+	Domain   string `yaml:"domain,omitempty"`
+	Insecure bool   `yaml:"insecure,omitempty"` // allow cookie over http, only for development
+	SameSite string `yaml:"sameSite,omitempty"` // lax (default), strict or none
 }
 
 type TLS struct {
@@ -64,6 +75,14 @@ type Log struct {
 type Database struct {
 	Mysql  *Mysql  `yaml:"mysql"`
 	SQLite *SQLite `yaml:"sqlite"`
+	Argon2 *Argon2 `yaml:"argon2,omitempty"`
+}
+
+// password hash cost, raise over time, hash is upgraded on next login. default is used if nil
+type Argon2 struct {
+	Memory      uint32 `yaml:"memory"` // KiB
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
 }
 
 type SQLite struct {
@@ -97,11 +116,40 @@ type RpcObject struct {
 type Key struct {
 	Jwtkey          string `yaml:"jwtkey"`
 	SessionStateKey string `yaml:"sessionStateKey"`
+	RefreshKey      string `yaml:"refreshKey"` // hmac key of refresh token digest, changing it invalidates every session
+	Issuer          string `yaml:"issuer"`     // iss of access token, differ per environment
+	Audience        string `yaml:"audience"`   // aud of access token, differ per environment
+	Jwt             *Jwt   `yaml:"jwt,omitempty"`
+}
+
+type Jwt struct {
+	Signing string   `yaml:"signing"` // kid of key used to sign new token
+	Keys    []JwtKey `yaml:"keys"`
+}
+
+type JwtKey struct {
+	Kid        string `yaml:"kid"`
+	Algorithm  string `yaml:"algorithm"`            // RS256 or EdDSA
+	PrivateKey string `yaml:"privateKey,omitempty"` // pem file path, required for signing key
+	PublicKey  string `yaml:"publicKey,omitempty"`  // pem file path, verification only key
 }
 
 type Oauth struct {
-	Github *Github `yaml:"github,omitempty"`
-	Kakao  *Kakao  `yaml:"kakao,omitempty"`
+	Github  *Github   `yaml:"github,omitempty"`
+	Kakao   *Kakao    `yaml:"kakao,omitempty"`
+	Oidc    []*Oidc   `yaml:"oidc,omitempty"`    // generic openid connect providers
+	Apps    []*App    `yaml:"apps,omitempty"`    // app clients receive one-time code by redirect
+	Devices []*Device `yaml:"devices,omitempty"` // input constrained clients use device authorization grant
+}
+
+type App struct {
+	Id        string   `yaml:"id"`
+	Redirects []string `yaml:"redirects"` // allowed redirect uris, custom scheme or universal link, exact match
+}
+
+type Device struct {
+	Id   string `yaml:"id"`
+	Name string `yaml:"name"` // shown to user on verification page
 }
 
 type Github struct {
@@ -116,6 +164,31 @@ type Kakao struct {
 	Redirect string `yaml:"redirect"`
 }
 
+type Oidc struct {
+	Name        string     `yaml:"name"`        // routes are /auth/{name}/login and /auth/{name}/callback
+	AccountType int        `yaml:"accountType"` // stored with identity, unique and never changed
+	Issuer      string     `yaml:"issuer"`      // discovery document is fetched from issuer
+	Id          string     `yaml:"id"`
+	Secret      string     `yaml:"secret"`
+	Redirect    string     `yaml:"redirect"`
+	Scopes      []string   `yaml:"scopes,omitempty"` // default openid, email, profile
+	Claims      OidcClaims `yaml:"claims,omitempty"`
+}
+
+// claim names of id token, empty is default
+type OidcClaims struct {
+	Subject       string `yaml:"subject,omitempty"`       // default sub
+	Email         string `yaml:"email,omitempty"`         // default email
+	EmailVerified string `yaml:"emailVerified,omitempty"` // default email_verified
+	Username      string `yaml:"username,omitempty"`      // default preferred_username
+}
+
+type Webauthn struct {
+	RPID          string   `yaml:"rpId"`          // domain without scheme and port
+	RPDisplayName string   `yaml:"rpDisplayName"` // display name of relying party
+	RPOrigins     []string `yaml:"rpOrigins"`     // fully qualified origins, include app origin
+}
+
 type Storage struct {
 	S3    *S3    `yaml:"s3,omitempty"`
 	Local *Local `yaml:"local,omitempty"`
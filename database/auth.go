@@ -7,21 +7,20 @@ import (
 	"github.com/capdale/was/model"
 	"github.com/capdale/was/types/binaryuuid"
 	"github.com/capdale/was/types/claimer"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 var ErrNoAffectedRow = errors.New("there is no specific row")
 
 func (d *DB) GetUserClaimByID(claimerId uint64) (*claimer.Claimer, error) {
-	var authUUID binaryuuid.UUID
+	user := &model.User{}
 	if err := d.DB.
 		Select("auth_uuid").
 		Where("id = ?", claimerId).
-		First(authUUID).Error; err != nil {
+		First(user).Error; err != nil {
 		return nil, err
 	}
-	return claimer.New(&authUUID), nil
+	return claimer.New(&user.AuthUUID), nil
 }
 
 func getUserIdByClaimer(tx *gorm.DB, claimer *claimer.Claimer) (uint64, error) {
@@ -38,11 +37,11 @@ func getUserIdByClaimer(tx *gorm.DB, claimer *claimer.Claimer) (uint64, error) {
 	return user.Id, nil
 }
 
-func (d *DB) CreateRefreshToken(claimer claimer.Claimer, refreshTokenUID *binaryuuid.UUID, refreshToken *[]byte, notBefore time.Time, expiredAt time.Time, agent *string) error {
-	hashedToken, err := bcrypt.GenerateFromPassword(*refreshToken, bcrypt.MinCost)
-	if err != nil {
-		return err
-	}
+func (d *DB) GetUserIdByClaimer(claimer *claimer.Claimer) (uint64, error) {
+	return getUserIdByClaimer(d.DB, claimer)
+}
+
+func (d *DB) CreateRefreshToken(claimer claimer.Claimer, refreshTokenUID *binaryuuid.UUID, hashedRefreshToken []byte, sessionUID *binaryuuid.UUID, sessionCreatedAt time.Time, notBefore time.Time, expiredAt time.Time, agent *string, ip string) error {
 	return d.DB.Transaction(func(tx *gorm.DB) error {
 		claimerId, err := getUserIdByClaimer(tx, &claimer)
 		if err != nil {
@@ -50,96 +49,158 @@ func (d *DB) CreateRefreshToken(claimer claimer.Claimer, refreshTokenUID *binary
 		}
 
 		return tx.Create(&model.Token{
-			UserId:       claimerId,
-			UUID:         *refreshTokenUID,
-			RefreshToken: hashedToken,
-			NotBefore:    notBefore,
-			ExpireAt:     expiredAt,
-			UserAgent:    *agent,
+			UserId:           claimerId,
+			UUID:             *refreshTokenUID,
+			SessionUUID:      *sessionUID,
+			RefreshToken:     hashedRefreshToken,
+			NotBefore:        notBefore,
+			ExpireAt:         expiredAt,
+			SessionCreatedAt: sessionCreatedAt,
+			UserAgent:        *agent,
+			IPAddress:        ip,
 		}).Error
 	})
 
 }
 
-func (d *DB) PopRefreshToken(refreshTokenUID *binaryuuid.UUID) (*model.Token, error) {
+// lookup by digest of refresh token
+func (d *DB) GetRefreshToken(hashedRefreshToken []byte) (*model.Token, error) {
+	token := &model.Token{}
+	if err := d.DB.
+		Where("refresh_token = ?", hashedRefreshToken).
+		First(token).Error; err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// mark refresh token rotated, only one of concurrent rotation succeed
+func (d *DB) RotateRefreshToken(tokenId uint64) (bool, error) {
+	result := d.DB.
+		Model(&model.Token{}).
+		Where("id = ? AND rotated_at IS NULL", tokenId).
+		Update("rotated_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// remove every token in family (session), return live token of family
+func (d *DB) RemoveTokenFamily(userId uint64, sessionUID *binaryuuid.UUID) (*model.Token, error) {
 	token := &model.Token{}
 	err := d.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.
-			Where("uuid = ?", refreshTokenUID).
+			Where("user_id = ? AND session_uuid = ?", userId, sessionUID).
+			Order("created_at DESC").
 			First(token).Error; err != nil {
 			return err
 		}
-		if err := tx.
-			Where("id = ?", token.Id).
-			Delete(&model.Token{}).Error; err != nil {
-			return err
-		}
-		return nil
+		return tx.
+			Where("user_id = ? AND session_uuid = ?", userId, sessionUID).
+			Delete(&model.Token{}).Error
 	})
-	return token, err
-
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
 }
 
-func (d *DB) RemoveRefreshToken(refreshToken *[]byte) error {
-	result := d.DB.
-		Where("refresh_token = ?", refreshToken).
-		Delete(&model.Token{})
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected < 1 {
-		return ErrNoAffectedRow
-	}
-	return nil
+func (d *DB) CreateSecurityEvent(userId uint64, eventType string, sessionUID *binaryuuid.UUID, agent *string) error {
+	return d.DB.Create(&model.SecurityEvent{
+		UserId:      userId,
+		Type:        eventType,
+		SessionUUID: *sessionUID,
+		UserAgent:   *agent,
+	}).Error
 }
 
 func (d *DB) QueryAllTokensByUserId(userId uint64) (*[]*model.Token, error) {
-	tokenMs := []model.Token{}
+	tokenMs := []*model.Token{}
 	if err := d.DB.
-		Where("id = ?", userId).
+		Where("user_id = ?", userId).
+		Order("created_at DESC").
 		Find(&tokenMs).Error; err != nil {
 		return nil, err
 	}
 
-	deleteRefreshTokens := []*[]byte{}
+	expiredTokenIds := []uint64{}
 	tokens := []*model.Token{}
 	curTime := time.Now()
 
 	for _, token := range tokenMs {
-		if token.ExpireAt.Before(curTime) {
-			tokens = append(tokens, &token)
-		} else {
-			deleteRefreshTokens = append(deleteRefreshTokens, &token.RefreshToken)
+		if !token.ExpireAt.After(curTime) {
+			expiredTokenIds = append(expiredTokenIds, token.Id)
+		} else if token.RotatedAt == nil {
+			tokens = append(tokens, token)
 		}
 	}
-	go d.RemoveTokens(&deleteRefreshTokens)
+	if len(expiredTokenIds) > 0 {
+		go d.RemoveTokens(&expiredTokenIds)
+	}
 	return &tokens, nil
 }
 
-func (d *DB) RemoveTokens(refreshTokens *[]*[]byte) error {
+func (d *DB) QueryAllTokensByClaimer(claimer *claimer.Claimer) (*[]*model.Token, error) {
+	claimerId, err := getUserIdByClaimer(d.DB, claimer)
+	if err != nil {
+		return nil, err
+	}
+	return d.QueryAllTokensByUserId(claimerId)
+}
+
+func (d *DB) RemoveTokens(tokenIds *[]uint64) error {
 	err := d.DB.
-		Where("refresh_token = ?", refreshTokens).
+		Where("id IN ?", *tokenIds).
 		Delete(&model.Token{}).Error
 	return err
 }
 
-func (d *DB) IsTokenPair(claimer claimer.Claimer, tokenExpiredAt time.Time, refreshToken *[]byte) error {
-	return d.DB.Transaction(func(tx *gorm.DB) error {
-		claimerId, err := getUserIdByClaimer(tx, &claimer)
+// remove session of claimer, return removed session token
+func (d *DB) RemoveSession(claimer *claimer.Claimer, sessionUID *binaryuuid.UUID) (*model.Token, error) {
+	token := &model.Token{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
 		if err != nil {
 			return err
 		}
-		result := tx.
-			Where("not_before = ? AND refresh_token = ? AND user_id = ?", tokenExpiredAt, refreshToken, claimerId).
-			First(&model.Token{})
-		if result.Error != nil {
-			return result.Error
+		if err := tx.
+			Where("user_id = ? AND session_uuid = ?", claimerId, sessionUID).
+			Order("created_at DESC").
+			First(token).Error; err != nil {
+			return err
+		}
+		return tx.
+			Where("user_id = ? AND session_uuid = ?", claimerId, sessionUID).
+			Delete(&model.Token{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// remove all sessions of claimer except current session, return removed session tokens
+func (d *DB) RemoveOtherSessions(claimer *claimer.Claimer, currentSessionUID *binaryuuid.UUID) (*[]*model.Token, error) {
+	tokens := []*model.Token{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
 		}
-		if result.RowsAffected < 1 {
-			return ErrNoAffectedRow
+		if err := tx.
+			Where("user_id = ? AND session_uuid <> ? AND rotated_at IS NULL", claimerId, currentSessionUID).
+			Find(&tokens).Error; err != nil {
+			return err
 		}
-		return nil
+		return tx.
+			Where("user_id = ? AND session_uuid <> ?", claimerId, currentSessionUID).
+			Delete(&model.Token{}).Error
 	})
+	if err != nil {
+		return nil, err
+	}
+	return &tokens, nil
 }
 
 func (d *DB) DeleteUserAccount(claimer *claimer.Claimer) error {
@@ -156,3 +217,49 @@ func (d *DB) DeleteUserAccount(claimer *claimer.Claimer) error {
 		return tx.Delete(&model.User{}, claimerId).Error
 	})
 }
+
+func (d *DB) GetTokenEpoch(claimer *claimer.Claimer) (uint64, error) {
+	user := &model.User{}
+	if err := d.DB.
+		Select("token_epoch").
+		Where("auth_uuid = ?", claimer).
+		First(user).Error; err != nil {
+		return 0, err
+	}
+	return user.TokenEpoch, nil
+}
+
+// increase token epoch and remove all refresh tokens, personal access tokens and oauth grants of user, return new epoch
+func (d *DB) IncreaseTokenEpoch(claimer *claimer.Claimer) (uint64, error) {
+	user := &model.User{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Model(&model.User{}).
+			Where("auth_uuid = ?", claimer).
+			Update("token_epoch", gorm.Expr("token_epoch + ?", 1)).Error; err != nil {
+			return err
+		}
+		if err := tx.
+			Select("id", "token_epoch").
+			Where("auth_uuid = ?", claimer).
+			First(user).Error; err != nil {
+			return err
+		}
+		if err := tx.
+			Where("user_id = ?", user.Id).
+			Delete(&model.PersonalAccessToken{}).Error; err != nil {
+			return err
+		}
+		// third-party apps must be authorized again
+		if err := deleteOAuthGrants(tx, "user_id = ?", user.Id); err != nil {
+			return err
+		}
+		return tx.
+			Where("user_id = ?", user.Id).
+			Delete(&model.Token{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return user.TokenEpoch, nil
+}
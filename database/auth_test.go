@@ -0,0 +1,130 @@
+package database
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) mustCreateSession(account *TestAccount) binaryuuid.UUID {
+	tokenUID, _ := binaryuuid.NewRandom()
+	sessionUID, _ := binaryuuid.NewRandom()
+	hashed := sha256.Sum256(tokenUID[:])
+	agent := "test agent"
+	err := s.d.CreateRefreshToken(*account.Claim, &tokenUID, hashed[:], &sessionUID, time.Now(), time.Now().Add(time.Minute*30), time.Now().Add(time.Hour), &agent, "203.0.113.1")
+	assert.Nil(s.T(), err)
+	return sessionUID
+}
+
+func (s *DatabaseSuite) TestSessions() {
+	user1 := s.MustCreateAccount()
+	user2 := s.MustCreateAccount()
+
+	session1 := s.mustCreateSession(user1)
+	session2 := s.mustCreateSession(user1)
+	session3 := s.mustCreateSession(user1)
+	s.mustCreateSession(user2)
+
+	tokens, err := s.d.QueryAllTokensByClaimer(user1.Claim)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), *tokens, 3)
+
+	// other user cannot remove session
+	_, err = s.d.RemoveSession(user2.Claim, &session1)
+	assert.NotNil(s.T(), err)
+
+	token, err := s.d.RemoveSession(user1.Claim, &session1)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), session1, token.SessionUUID)
+
+	// remove all except session2
+	removed, err := s.d.RemoveOtherSessions(user1.Claim, &session2)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), *removed, 1)
+	assert.Equal(s.T(), session3, (*removed)[0].SessionUUID)
+
+	tokens, _ = s.d.QueryAllTokensByClaimer(user1.Claim)
+	assert.Len(s.T(), *tokens, 1)
+	assert.Equal(s.T(), session2, (*tokens)[0].SessionUUID)
+
+	// user2 session not affected
+	tokens, _ = s.d.QueryAllTokensByClaimer(user2.Claim)
+	assert.Len(s.T(), *tokens, 1)
+}
+
+func (s *DatabaseSuite) TestRotateRefreshToken() {
+	user := s.MustCreateAccount()
+	session := s.mustCreateSession(user)
+
+	tokens, _ := s.d.QueryAllTokensByClaimer(user.Claim)
+	token, err := s.d.GetRefreshToken((*tokens)[0].RefreshToken)
+	assert.Nil(s.T(), err)
+
+	// only first rotation succeed
+	rotated, err := s.d.RotateRefreshToken(token.Id)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), rotated)
+	rotated, err = s.d.RotateRefreshToken(token.Id)
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), rotated)
+
+	// rotated token is kept, but not listed as session
+	token, err = s.d.GetRefreshToken(token.RefreshToken)
+	assert.Nil(s.T(), err)
+	assert.NotNil(s.T(), token.RotatedAt)
+	tokens, _ = s.d.QueryAllTokensByClaimer(user.Claim)
+	assert.Len(s.T(), *tokens, 0)
+
+	// revoke family
+	_, err = s.d.RemoveTokenFamily(token.UserId, &session)
+	assert.Nil(s.T(), err)
+	_, err = s.d.GetRefreshToken(token.RefreshToken)
+	assert.NotNil(s.T(), err)
+
+	agent := "test agent"
+	err = s.d.CreateSecurityEvent(token.UserId, model.SecurityEventRefreshTokenReuse, &session, &agent)
+	assert.Nil(s.T(), err)
+}
+
+func (s *DatabaseSuite) TestIncreaseTokenEpoch() {
+	user := s.MustCreateAccount()
+	s.mustCreateSession(user)
+	s.mustCreateSession(user)
+
+	epoch, err := s.d.GetTokenEpoch(user.Claim)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), uint64(0), epoch)
+
+	epoch, err = s.d.IncreaseTokenEpoch(user.Claim)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), uint64(1), epoch)
+
+	epoch, _ = s.d.GetTokenEpoch(user.Claim)
+	assert.Equal(s.T(), uint64(1), epoch)
+
+	// all refresh tokens removed
+	tokens, _ := s.d.QueryAllTokensByClaimer(user.Claim)
+	assert.Len(s.T(), *tokens, 0)
+}
+
+func (s *DatabaseSuite) TestLegacyRefreshTokenMigration() {
+	user := s.MustCreateAccount()
+	s.mustCreateSession(user)
+	legacy := s.mustCreateSession(user)
+
+	// database of older version, bcrypt hash without index
+	assert.Nil(s.T(), s.d.DB.Migrator().DropIndex(&model.Token{}, "RefreshToken"))
+	bcryptHash := []byte("$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy")
+	assert.Nil(s.T(), s.d.DB.Model(&model.Token{}).Where("session_uuid = ?", legacy).Update("refresh_token", bcryptHash).Error)
+
+	assert.Nil(s.T(), s.d.AutoMigrate())
+	assert.True(s.T(), s.d.DB.Migrator().HasIndex(&model.Token{}, "RefreshToken"))
+
+	// only legacy session is logged out
+	tokens, _ := s.d.QueryAllTokensByClaimer(user.Claim)
+	assert.Len(s.T(), *tokens, 1)
+	assert.NotEqual(s.T(), legacy, (*tokens)[0].SessionUUID)
+}
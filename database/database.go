@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/capdale/was/auth/passhash"
 	"github.com/capdale/was/config"
 	"github.com/capdale/was/model"
 	"gorm.io/driver/mysql"
@@ -13,7 +14,8 @@ import (
 )
 
 type DB struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	hasher *passhash.Hasher
 }
 
 func (d *DB) Close() (err error) {
@@ -26,13 +28,32 @@ func (d *DB) Close() (err error) {
 }
 
 func New(databaseConfig *config.Database, lvl logger.LogLevel) (db *DB, err error) {
+	var params *passhash.Params
+	if databaseConfig.Argon2 != nil {
+		params = &passhash.Params{
+			Memory:      databaseConfig.Argon2.Memory,
+			Iterations:  databaseConfig.Argon2.Iterations,
+			Parallelism: databaseConfig.Argon2.Parallelism,
+		}
+		if err := params.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	if databaseConfig.SQLite != nil {
-		return NewSQLite(databaseConfig.SQLite, lvl)
+		db, err = NewSQLite(databaseConfig.SQLite, lvl)
+	} else if databaseConfig.Mysql != nil {
+		db, err = NewMySQL(databaseConfig.Mysql, lvl)
+	} else {
+		return nil, config.ErrEmailConfig
 	}
-	if databaseConfig.Mysql != nil {
-		return NewMySQL(databaseConfig.Mysql, lvl)
+	if err != nil {
+		return
 	}
-	return nil, config.ErrEmailConfig
+	if params != nil {
+		db.hasher = passhash.New(params)
+	}
+	return
 }
 
 func NewSQLite(sqliteConfig *config.SQLite, lvl logger.LogLevel) (db *DB, err error) {
@@ -44,7 +65,8 @@ func NewSQLite(sqliteConfig *config.SQLite, lvl logger.LogLevel) (db *DB, err er
 	}
 
 	db = &DB{
-		DB: d,
+		DB:     d,
+		hasher: passhash.New(nil),
 	}
 	err = db.AutoMigrate()
 	return
@@ -75,7 +97,8 @@ func NewMySQL(mysqlConfig *config.Mysql, lvl logger.LogLevel) (db *DB, err error
 	sqldb.SetConnMaxLifetime(time.Second * time.Duration(mysqlConfig.MaxLifetime))
 
 	db = &DB{
-		DB: d,
+		DB:     d,
+		hasher: passhash.New(nil),
 	}
 	err = db.AutoMigrate()
 
@@ -83,8 +106,18 @@ func NewMySQL(mysqlConfig *config.Mysql, lvl logger.LogLevel) (db *DB, err error
 }
 
 func (d *DB) AutoMigrate() (err error) {
+	// refresh token was bcrypt hash, not indexable, sessions of legacy token are logged out once
+	if d.DB.Migrator().HasTable(&model.Token{}) && !d.DB.Migrator().HasIndex(&model.Token{}, "RefreshToken") {
+		if err = d.DB.
+			Where("LENGTH(refresh_token) <> ?", 32).
+			Delete(&model.Token{}).Error; err != nil {
+			return
+		}
+	}
 	err = d.DB.AutoMigrate(
 		&model.User{}, &model.Token{}, &model.SocialUser{}, &model.OriginUser{}, &model.Ticket{},
+		&model.SecurityEvent{}, &model.KnownDevice{}, &model.RecoveryCode{}, &model.WebauthnCredential{}, &model.PersonalAccessToken{}, &model.Identity{},
+		&model.OAuthClient{}, &model.OAuthGrant{}, &model.OAuthToken{},
 		&model.UserDisplayType{}, &model.UserFollow{}, &model.UserFollowRequest{},
 		&model.Collection{},
 		&model.ReportUser{}, &model.ReportArticle{}, &model.ReportBug{}, &model.ReportHelp{}, &model.ReportEtc{},
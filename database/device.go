@@ -0,0 +1,60 @@
+package database
+
+import (
+	"time"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+// record device of login, return user (id, email) and whether device is new to user.
+// device is known if ua family is same and ip prefix or country is same, first device of user is never new
+func (d *DB) SaveKnownDevice(claimer *claimer.Claimer, uaFamily string, ipPrefix string, country string) (*model.User, bool, error) {
+	user := &model.User{}
+	newDevice := false
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Select("id", "email").
+			Where("auth_uuid = ?", claimer).
+			First(user).Error; err != nil {
+			return err
+		}
+
+		query := tx.Where("user_id = ? AND ua_family = ?", user.Id, uaFamily)
+		if country != "" {
+			query = query.Where("ip_prefix = ? OR country = ?", ipPrefix, country)
+		} else {
+			query = query.Where("ip_prefix = ?", ipPrefix)
+		}
+		device := &model.KnownDevice{}
+		err := query.First(device).Error
+		if err == nil {
+			return tx.Model(device).Update("last_seen_at", time.Now()).Error
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		var count int64
+		if err := tx.
+			Model(&model.KnownDevice{}).
+			Where("user_id = ?", user.Id).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		newDevice = count > 0
+
+		return tx.Create(&model.KnownDevice{
+			UserId:     user.Id,
+			UAFamily:   uaFamily,
+			IPPrefix:   ipPrefix,
+			Country:    country,
+			LastSeenAt: time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return user, newDevice, nil
+}
@@ -0,0 +1,41 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestKnownDevice() {
+	user := s.MustCreateAccount()
+
+	// first device is not alerted
+	saved, newDevice, err := s.d.SaveKnownDevice(user.Claim, "Chrome on Windows", "203.0.113.0/24", "KR")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), newDevice)
+	assert.Equal(s.T(), user.Email, saved.Email)
+
+	// same network
+	_, newDevice, err = s.d.SaveKnownDevice(user.Claim, "Chrome on Windows", "203.0.113.0/24", "KR")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), newDevice)
+
+	// other network in same country
+	_, newDevice, err = s.d.SaveKnownDevice(user.Claim, "Chrome on Windows", "198.51.100.0/24", "KR")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), newDevice)
+
+	// other browser
+	_, newDevice, err = s.d.SaveKnownDevice(user.Claim, "Firefox on Linux", "203.0.113.0/24", "KR")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), newDevice)
+
+	// other country, geoip is not configured
+	_, newDevice, err = s.d.SaveKnownDevice(user.Claim, "Chrome on Windows", "192.0.2.0/24", "")
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), newDevice)
+
+	// other user has own devices
+	other := s.MustCreateAccount()
+	_, newDevice, err = s.d.SaveKnownDevice(other.Claim, "Firefox on Linux", "203.0.113.0/24", "KR")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), newDevice)
+}
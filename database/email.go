@@ -0,0 +1,97 @@
+package database
+
+import (
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+// create ticket sent to new email, return current email to notice
+func (d *DB) CreateEmailChangeTicket(claimer *claimer.Claimer, sessionUID *binaryuuid.UUID, email string) (string, *binaryuuid.UUID, error) {
+	var currentEmail string
+	ticket := &model.Ticket{
+		Email:       email,
+		Type:        model.TicketTypeEmailChange,
+		SessionUUID: *sessionUID,
+	}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		user := &model.User{}
+		if err := tx.
+			Select("users.id", "users.email").
+			Joins("INNER JOIN origin_users ON origin_users.id = users.id").
+			Where("auth_uuid = ?", claimer).
+			First(user).Error; err != nil {
+			return err
+		}
+		emailUsed, err := isEmailUsed(tx, email)
+		if err != nil {
+			return err
+		}
+		if emailUsed {
+			return ErrEmailAlreadyUsed
+		}
+		currentEmail = user.Email
+		ticket.UserId = user.Id
+		return tx.Create(ticket).Error
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return currentEmail, &ticket.UUID, nil
+}
+
+func (d *DB) GetEmailByEmailChangeTicket(ticketUUID *binaryuuid.UUID) (string, error) {
+	ticket, err := d.getTicket(ticketUUID, model.TicketTypeEmailChange)
+	if err != nil {
+		return "", err
+	}
+	return ticket.Email, nil
+}
+
+// switch email of user, return claimer and session which requested change
+func (d *DB) ChangeEmailViaTicket(ticketUUID *binaryuuid.UUID) (*claimer.Claimer, *binaryuuid.UUID, error) {
+	ticket, err := d.getTicket(ticketUUID, model.TicketTypeEmailChange)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := &model.User{}
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		// ticket is single use
+		result := tx.
+			Where("uuid = ? AND type = ?", ticket.UUID, model.TicketTypeEmailChange).
+			Delete(&model.Ticket{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoAffectedRow
+		}
+
+		if err := tx.
+			Select("id", "auth_uuid").
+			Where("id = ?", ticket.UserId).
+			First(user).Error; err != nil {
+			return err
+		}
+
+		// email can be taken after ticket created
+		emailUsed, err := isEmailUsed(tx, ticket.Email)
+		if err != nil {
+			return err
+		}
+		if emailUsed {
+			return ErrEmailAlreadyUsed
+		}
+
+		return tx.
+			Model(&model.User{}).
+			Where("id = ?", user.Id).
+			Update("email", ticket.Email).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return claimer.New(&user.AuthUUID), &ticket.SessionUUID, nil
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestChangeEmail() {
+	user := s.MustCreateAccount()
+	other := s.MustCreateAccount()
+	session := s.mustCreateSession(user)
+
+	_, _, err := s.d.CreateEmailChangeTicket(user.Claim, &session, other.Email)
+	assert.ErrorIs(s.T(), err, ErrEmailAlreadyUsed)
+
+	newEmail := "changed@test.test"
+	currentEmail, ticket, err := s.d.CreateEmailChangeTicket(user.Claim, &session, newEmail)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), user.Email, currentEmail)
+
+	email, err := s.d.GetEmailByEmailChangeTicket(ticket)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), newEmail, email)
+
+	claimer, sessionUID, err := s.d.ChangeEmailViaTicket(ticket)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), *user.Claim, *claimer)
+	assert.Equal(s.T(), session, *sessionUID)
+
+	used, _ := s.d.IsEmailUsed(newEmail)
+	assert.True(s.T(), used)
+	used, _ = s.d.IsEmailUsed(user.Email)
+	assert.False(s.T(), used)
+
+	// ticket is single use
+	_, _, err = s.d.ChangeEmailViaTicket(ticket)
+	assert.NotNil(s.T(), err)
+}
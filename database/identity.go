@@ -0,0 +1,204 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLastIdentity       = errors.New("last login method cannot be removed")
+	ErrPasswordAlreadySet = errors.New("password already set")
+)
+
+func (d *DB) GetUserByIdentity(accountType int, subject string) (*model.User, error) {
+	user := &model.User{}
+	if err := d.DB.
+		Select("users.id", "users.username", "users.auth_uuid", "users.email", "users.account_type").
+		Joins("INNER JOIN identities ON identities.user_id = users.id").
+		Where("identities.account_type = ? AND identities.subject = ?", accountType, subject).
+		First(user).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// count login methods of user, social identities and password
+func countLoginMethods(tx *gorm.DB, userId uint64) (int64, error) {
+	var identities, passwords int64
+	if err := tx.
+		Model(&model.Identity{}).
+		Where("user_id = ?", userId).
+		Count(&identities).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.
+		Model(&model.OriginUser{}).
+		Where("id = ?", userId).
+		Count(&passwords).Error; err != nil {
+		return 0, err
+	}
+	return identities + passwords, nil
+}
+
+// social user created before identities has no identity, attach at first login, false if user is not such user
+func (d *DB) AttachLegacyIdentity(user *model.User, identity *model.Identity) (bool, error) {
+	if user.AccountType != identity.AccountType {
+		return false, nil
+	}
+	attached := false
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		count, err := countLoginMethods(tx, user.Id)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		identity.UserId = user.Id
+		if err := tx.Create(identity).Error; err != nil {
+			return err
+		}
+		attached = true
+		return nil
+	})
+	return attached, err
+}
+
+func (d *DB) CreateIdentity(claimer *claimer.Claimer, identity *model.Identity) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		identity.UserId = claimerId
+		return tx.Create(identity).Error
+	})
+}
+
+func (d *DB) GetIdentities(claimer *claimer.Claimer) (*[]*model.IdentityAPI, error) {
+	identities := []*model.Identity{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		return tx.
+			Where("user_id = ?", claimerId).
+			Order("id").
+			Find(&identities).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	identitiesAPI := make([]*model.IdentityAPI, len(identities))
+	for i, identity := range identities {
+		identitiesAPI[i] = &model.IdentityAPI{
+			AccountType: model.AccountTypeName(identity.AccountType),
+			Email:       identity.Email,
+			CreatedAt:   identity.CreatedAt,
+		}
+	}
+	return &identitiesAPI, nil
+}
+
+func (d *DB) HasPassword(claimer *claimer.Claimer) (bool, error) {
+	var count int64
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		return tx.
+			Model(&model.OriginUser{}).
+			Where("id = ?", claimerId).
+			Count(&count).Error
+	})
+	return count > 0, err
+}
+
+// unlink social identity, at least one login method is kept
+func (d *DB) DeleteIdentity(claimer *claimer.Claimer, accountType int) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		count, err := countLoginMethods(tx, claimerId)
+		if err != nil {
+			return err
+		}
+		if count < 2 {
+			return ErrLastIdentity
+		}
+		result := tx.
+			Where("user_id = ? AND account_type = ?", claimerId, accountType).
+			Delete(&model.Identity{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoAffectedRow
+		}
+		return nil
+	})
+}
+
+// add password login to social user, username is used to login
+func (d *DB) CreatePassword(claimer *claimer.Claimer, password string) error {
+	hashed, err := d.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.
+			Model(&model.OriginUser{}).
+			Where("id = ?", claimerId).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrPasswordAlreadySet
+		}
+		return tx.Create(&model.OriginUser{
+			Id:     int64(claimerId),
+			Hashed: hashed,
+		}).Error
+	})
+}
+
+// remove password login with totp and recovery codes, at least one login method is kept
+func (d *DB) DeletePassword(claimer *claimer.Claimer) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		count, err := countLoginMethods(tx, claimerId)
+		if err != nil {
+			return err
+		}
+		if count < 2 {
+			return ErrLastIdentity
+		}
+		result := tx.
+			Where("id = ?", claimerId).
+			Delete(&model.OriginUser{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoAffectedRow
+		}
+		return tx.
+			Where("user_id = ?", claimerId).
+			Delete(&model.RecoveryCode{}).Error
+	})
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestIdentity() {
+	user, err := s.d.CreateWithIdentity("githubuser", &model.Identity{AccountType: model.AccountTypeGithub, Subject: "101", Email: "github@test.test"})
+	assert.Nil(s.T(), err)
+	claim := claimer.New(&user.AuthUUID)
+
+	found, err := s.d.GetUserByIdentity(model.AccountTypeGithub, "101")
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), user.Id, found.Id)
+
+	err = s.d.CreateIdentity(claim, &model.Identity{AccountType: model.AccountTypeKakao, Subject: "202", Email: "kakao@test.test"})
+	assert.Nil(s.T(), err)
+
+	// identity of provider can be linked to only one user
+	other := s.MustCreateAccount()
+	err = s.d.CreateIdentity(other.Claim, &model.Identity{AccountType: model.AccountTypeKakao, Subject: "202"})
+	assert.NotNil(s.T(), err)
+
+	identities, err := s.d.GetIdentities(claim)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), *identities, 2)
+	assert.Equal(s.T(), "kakao", (*identities)[1].AccountType)
+
+	hasPassword, err := s.d.HasPassword(claim)
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), hasPassword)
+
+	assert.Nil(s.T(), s.d.DeleteIdentity(claim, model.AccountTypeKakao))
+	assert.ErrorIs(s.T(), s.d.DeleteIdentity(claim, model.AccountTypeKakao), ErrLastIdentity)
+	assert.ErrorIs(s.T(), s.d.DeleteIdentity(claim, model.AccountTypeGithub), ErrLastIdentity)
+
+	assert.Nil(s.T(), s.d.CreatePassword(claim, "Testtest1234!@"))
+	assert.ErrorIs(s.T(), s.d.CreatePassword(claim, "Testtest1234!@"), ErrPasswordAlreadySet)
+	_, err = s.d.GetOriginUserClaim("githubuser", "Testtest1234!@")
+	assert.Nil(s.T(), err)
+
+	assert.Nil(s.T(), s.d.DeleteIdentity(claim, model.AccountTypeGithub))
+	assert.ErrorIs(s.T(), s.d.DeletePassword(claim), ErrLastIdentity)
+}
+
+func (s *DatabaseSuite) TestAttachLegacyIdentity() {
+	user, err := s.d.CreateWithIdentity("kakaouser", &model.Identity{AccountType: model.AccountTypeKakao, Subject: "303", Email: "kakao@test.test"})
+	assert.Nil(s.T(), err)
+
+	// user already has identity
+	attached, err := s.d.AttachLegacyIdentity(user, &model.Identity{AccountType: model.AccountTypeKakao, Subject: "304"})
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), attached)
+
+	// user created before identities
+	s.d.DB.Where("user_id = ?", user.Id).Delete(&model.Identity{})
+	attached, err = s.d.AttachLegacyIdentity(user, &model.Identity{AccountType: model.AccountTypeKakao, Subject: "304"})
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), attached)
+
+	// origin user cannot be attached
+	origin := s.MustCreateAccount()
+	originUser, err := s.d.GetUserByEmail(origin.Email)
+	assert.Nil(s.T(), err)
+	attached, err = s.d.AttachLegacyIdentity(originUser, &model.Identity{AccountType: model.AccountTypeOrigin, Subject: "305"})
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), attached)
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidTicketNonce = errors.New("invalid ticket nonce")
+
+// any user with email can login via magic link, return ErrNoUserExist (wrapping gorm.ErrRecordNotFound) if there is no such user with email
+func (d *DB) CreateMagicLinkTicket(email string, hashedNonce []byte) (*binaryuuid.UUID, error) {
+	user := &model.User{}
+	if err := d.DB.
+		Select("id").
+		Where("email = ?", email).
+		First(user).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("%w: %w", ErrNoUserExist, err)
+		}
+		return nil, err
+	}
+
+	ticket := &model.Ticket{
+		Email:  email,
+		Type:   model.TicketTypeMagicLink,
+		UserId: user.Id,
+		Nonce:  hashedNonce,
+	}
+	if err := d.DB.Create(ticket).Error; err != nil {
+		return nil, err
+	}
+	return &ticket.UUID, nil
+}
+
+func (d *DB) GetEmailByMagicLinkTicket(ticketUUID *binaryuuid.UUID) (string, error) {
+	ticket, err := d.getTicket(ticketUUID, model.TicketTypeMagicLink)
+	if err != nil {
+		return "", err
+	}
+	return ticket.Email, nil
+}
+
+// ticket is consumed only by device which requested it, so leaked link alone is not enough to login
+func (d *DB) LoginViaMagicLinkTicket(ticketUUID *binaryuuid.UUID, hashedNonce []byte) (*claimer.Claimer, error) {
+	ticket, err := d.getTicket(ticketUUID, model.TicketTypeMagicLink)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(ticket.Nonce, hashedNonce) != 1 {
+		return nil, ErrInvalidTicketNonce
+	}
+
+	user := &model.User{}
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		// ticket is single use
+		result := tx.
+			Where("uuid = ? AND type = ?", ticket.UUID, model.TicketTypeMagicLink).
+			Delete(&model.Ticket{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoAffectedRow
+		}
+
+		// email can be changed after ticket created
+		return tx.
+			Select("id", "auth_uuid").
+			Where("id = ? AND email = ?", ticket.UserId, ticket.Email).
+			First(user).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimer.New(&user.AuthUUID), nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"crypto/sha256"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestMagicLink() {
+	user := s.MustCreateAccount()
+	nonce := sha256.Sum256([]byte("nonce"))
+	otherNonce := sha256.Sum256([]byte("other nonce"))
+
+	_, err := s.d.CreateMagicLinkTicket("notexist@test.test", nonce[:])
+	assert.ErrorIs(s.T(), err, ErrNoUserExist)
+
+	ticket, err := s.d.CreateMagicLinkTicket(user.Email, nonce[:])
+	assert.Nil(s.T(), err)
+
+	// magic link ticket cannot be used for password reset
+	_, err = s.d.GetEmailByPasswordResetTicket(ticket)
+	assert.NotNil(s.T(), err)
+
+	email, err := s.d.GetEmailByMagicLinkTicket(ticket)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), user.Email, email)
+
+	// other device cannot use ticket, and ticket is kept for requesting device
+	_, err = s.d.LoginViaMagicLinkTicket(ticket, otherNonce[:])
+	assert.ErrorIs(s.T(), err, ErrInvalidTicketNonce)
+
+	claimer, err := s.d.LoginViaMagicLinkTicket(ticket, nonce[:])
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), *user.Claim, *claimer)
+
+	// ticket is single use
+	_, err = s.d.LoginViaMagicLinkTicket(ticket, nonce[:])
+	assert.NotNil(s.T(), err)
+}
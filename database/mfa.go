@@ -0,0 +1,157 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("totp already enabled")
+	ErrTOTPNotStarted     = errors.New("totp enrollment not started")
+)
+
+type originTOTP struct {
+	Id          uint64
+	Username    string
+	TOTPSecret  []byte
+	TOTPEnabled bool
+}
+
+func getOriginTOTP(tx *gorm.DB, claimer *claimer.Claimer) (*originTOTP, error) {
+	totp := &originTOTP{}
+	if err := tx.
+		Model(&model.User{}).
+		Select("users.id", "users.username", "origin_users.totp_secret", "origin_users.totp_enabled").
+		Joins("INNER JOIN origin_users ON origin_users.id = users.id").
+		Where("auth_uuid = ?", claimer).
+		First(totp).Error; err != nil {
+		return nil, err
+	}
+	return totp, nil
+}
+
+// start totp enrollment, secret is not used until enabled, return username for provisioning
+func (d *DB) StartTOTP(claimer *claimer.Claimer, secret []byte) (string, error) {
+	var username string
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		totp, err := getOriginTOTP(tx, claimer)
+		if err != nil {
+			return err
+		}
+		if totp.TOTPEnabled {
+			return ErrTOTPAlreadyEnabled
+		}
+		username = totp.Username
+		return tx.
+			Model(&model.OriginUser{}).
+			Where("id = ?", totp.Id).
+			Update("totp_secret", secret).Error
+	})
+	return username, err
+}
+
+func (d *DB) GetTOTP(claimer *claimer.Claimer) (secret []byte, enabled bool, err error) {
+	totp, err := getOriginTOTP(d.DB, claimer)
+	if err != nil {
+		return nil, false, err
+	}
+	return totp.TOTPSecret, totp.TOTPEnabled, nil
+}
+
+// enable totp, previous recovery codes are replaced
+func (d *DB) EnableTOTP(claimer *claimer.Claimer, step int64, hashedRecoveryCodes *[][]byte) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		totp, err := getOriginTOTP(tx, claimer)
+		if err != nil {
+			return err
+		}
+		if totp.TOTPEnabled {
+			return ErrTOTPAlreadyEnabled
+		}
+		if len(totp.TOTPSecret) == 0 {
+			return ErrTOTPNotStarted
+		}
+		if err := tx.
+			Model(&model.OriginUser{}).
+			Where("id = ?", totp.Id).
+			Updates(map[string]interface{}{
+				"totp_enabled": true,
+				"totp_step":    step,
+			}).Error; err != nil {
+			return err
+		}
+		return replaceRecoveryCodes(tx, totp.Id, hashedRecoveryCodes)
+	})
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userId uint64, hashedRecoveryCodes *[][]byte) error {
+	if err := tx.
+		Where("user_id = ?", userId).
+		Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	codes := make([]*model.RecoveryCode, len(*hashedRecoveryCodes))
+	for i, hashed := range *hashedRecoveryCodes {
+		codes[i] = &model.RecoveryCode{
+			UserId: userId,
+			Hashed: hashed,
+		}
+	}
+	return tx.Create(&codes).Error
+}
+
+func (d *DB) DisableTOTP(claimer *claimer.Claimer) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		totp, err := getOriginTOTP(tx, claimer)
+		if err != nil {
+			return err
+		}
+		if err := tx.
+			Model(&model.OriginUser{}).
+			Where("id = ?", totp.Id).
+			Updates(map[string]interface{}{
+				"totp_secret":  nil,
+				"totp_enabled": false,
+				"totp_step":    0,
+			}).Error; err != nil {
+			return err
+		}
+		return tx.
+			Where("user_id = ?", totp.Id).
+			Delete(&model.RecoveryCode{}).Error
+	})
+}
+
+// mark totp step used, false if step (or later step) already used
+func (d *DB) UseTOTPStep(claimer *claimer.Claimer, step int64) (bool, error) {
+	userId, err := getUserIdByClaimer(d.DB, claimer)
+	if err != nil {
+		return false, err
+	}
+	result := d.DB.
+		Model(&model.OriginUser{}).
+		Where("id = ? AND totp_step < ?", userId, step).
+		Update("totp_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// recovery code is single use, false if not exist
+func (d *DB) UseRecoveryCode(claimer *claimer.Claimer, hashedCode []byte) (bool, error) {
+	userId, err := getUserIdByClaimer(d.DB, claimer)
+	if err != nil {
+		return false, err
+	}
+	result := d.DB.
+		Where("user_id = ? AND hashed = ?", userId, hashedCode).
+		Delete(&model.RecoveryCode{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
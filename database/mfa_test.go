@@ -0,0 +1,54 @@
+package database
+
+import (
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestTOTP() {
+	user := s.MustCreateAccount()
+	secret := []byte("12345678901234567890")
+
+	// enable before start is not allowed
+	codes := &[][]byte{[]byte("hashed code 1"), []byte("hashed code 2")}
+	err := s.d.EnableTOTP(user.Claim, 1, codes)
+	assert.ErrorIs(s.T(), err, ErrTOTPNotStarted)
+
+	username, err := s.d.StartTOTP(user.Claim, secret)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), user.Username, username)
+
+	storedSecret, enabled, err := s.d.GetTOTP(user.Claim)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), secret, storedSecret)
+	assert.False(s.T(), enabled)
+
+	err = s.d.EnableTOTP(user.Claim, 10, codes)
+	assert.Nil(s.T(), err)
+	_, enabled, _ = s.d.GetTOTP(user.Claim)
+	assert.True(s.T(), enabled)
+
+	// restart enrollment is not allowed after enabled
+	_, err = s.d.StartTOTP(user.Claim, secret)
+	assert.ErrorIs(s.T(), err, ErrTOTPAlreadyEnabled)
+
+	// step used in enable cannot be replayed
+	used, err := s.d.UseTOTPStep(user.Claim, 10)
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), used)
+	used, _ = s.d.UseTOTPStep(user.Claim, 11)
+	assert.True(s.T(), used)
+
+	// recovery code is single use
+	used, err = s.d.UseRecoveryCode(user.Claim, []byte("hashed code 1"))
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), used)
+	used, _ = s.d.UseRecoveryCode(user.Claim, []byte("hashed code 1"))
+	assert.False(s.T(), used)
+
+	err = s.d.DisableTOTP(user.Claim)
+	assert.Nil(s.T(), err)
+	_, enabled, _ = s.d.GetTOTP(user.Claim)
+	assert.False(s.T(), enabled)
+	used, _ = s.d.UseRecoveryCode(user.Claim, []byte("hashed code 2"))
+	assert.False(s.T(), used)
+}
@@ -0,0 +1,262 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+var ErrOAuthTokenExpired = errors.New("oauth token expired")
+
+func (d *DB) CreateOAuthClient(claimer *claimer.Claimer, client *model.OAuthClient) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		client.OwnerId = claimerId
+		return tx.Create(client).Error
+	})
+}
+
+func (d *DB) GetOAuthClient(clientId string) (*model.OAuthClient, error) {
+	client := &model.OAuthClient{}
+	if err := d.DB.
+		Where("client_id = ?", clientId).
+		First(client).Error; err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// clients registered by user
+func (d *DB) GetOAuthClients(claimer *claimer.Claimer) (*[]*model.OAuthClientAPI, error) {
+	clients := []*model.OAuthClient{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		return tx.
+			Where("owner_id = ?", claimerId).
+			Order("id").
+			Find(&clients).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	clientAPIs := make([]*model.OAuthClientAPI, len(clients))
+	for i, client := range clients {
+		clientAPIs[i] = &model.OAuthClientAPI{
+			ClientId:     client.ClientId,
+			Name:         client.Name,
+			RedirectURIs: client.RedirectURIs,
+			Scopes:       client.Scopes,
+			Confidential: client.HashedSecret != nil,
+			CreatedAt:    client.CreatedAt,
+		}
+	}
+	return &clientAPIs, nil
+}
+
+func deleteOAuthGrants(tx *gorm.DB, query string, args ...interface{}) error {
+	grantIds := tx.
+		Model(&model.OAuthGrant{}).
+		Select("id").
+		Where(query, args...)
+	if err := tx.
+		Where("grant_id IN (?)", grantIds).
+		Delete(&model.OAuthToken{}).Error; err != nil {
+		return err
+	}
+	return tx.
+		Where(query, args...).
+		Delete(&model.OAuthGrant{}).Error
+}
+
+// every grant and token of client is removed with client
+func (d *DB) DeleteOAuthClient(claimer *claimer.Claimer, clientId string) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		client := &model.OAuthClient{}
+		if err := tx.
+			Select("id").
+			Where("client_id = ? AND owner_id = ?", clientId, claimerId).
+			First(client).Error; err != nil {
+			return err
+		}
+		if err := deleteOAuthGrants(tx, "o_auth_client_id = ?", client.Id); err != nil {
+			return err
+		}
+		return tx.Delete(client).Error
+	})
+}
+
+// consent of user, scopes are replaced by latest consent
+func (d *DB) SaveOAuthGrant(claimer *claimer.Claimer, oauthClientId uint64, scopes string) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		grant := &model.OAuthGrant{}
+		err = tx.
+			Where("user_id = ? AND o_auth_client_id = ?", claimerId, oauthClientId).
+			First(grant).Error
+		if err == gorm.ErrRecordNotFound {
+			return tx.Create(&model.OAuthGrant{
+				UserId:        claimerId,
+				OAuthClientId: oauthClientId,
+				Scopes:        scopes,
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+		return tx.
+			Model(grant).
+			Update("scopes", scopes).Error
+	})
+}
+
+func (d *DB) GetOAuthGrants(claimer *claimer.Claimer) (*[]*model.OAuthGrantAPI, error) {
+	grants := []*model.OAuthGrantAPI{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		return tx.
+			Model(&model.OAuthGrant{}).
+			Select("o_auth_clients.client_id", "o_auth_clients.name", "o_auth_grants.scopes", "o_auth_grants.created_at", "o_auth_grants.updated_at").
+			Joins("INNER JOIN o_auth_clients ON o_auth_clients.id = o_auth_grants.o_auth_client_id").
+			Where("o_auth_grants.user_id = ?", claimerId).
+			Order("o_auth_grants.id").
+			Find(&grants).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &grants, nil
+}
+
+// revoke app, every token issued to app is removed
+func (d *DB) DeleteOAuthGrant(claimer *claimer.Claimer, clientId string) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		client := &model.OAuthClient{}
+		if err := tx.
+			Select("id").
+			Where("client_id = ?", clientId).
+			First(client).Error; err != nil {
+			return err
+		}
+		grant := &model.OAuthGrant{}
+		if err := tx.
+			Select("id").
+			Where("user_id = ? AND o_auth_client_id = ?", claimerId, client.Id).
+			First(grant).Error; err != nil {
+			return err
+		}
+		return deleteOAuthGrants(tx, "id = ?", grant.Id)
+	})
+}
+
+func createOAuthTokenPair(tx *gorm.DB, grantId uint64, scopes string, hashedAccess []byte, hashedRefresh []byte, accessExpiredAt time.Time, refreshExpiredAt time.Time) error {
+	return tx.Create(&[]*model.OAuthToken{
+		{
+			GrantId:   grantId,
+			Hashed:    hashedAccess,
+			Scopes:    scopes,
+			ExpiredAt: accessExpiredAt,
+		},
+		{
+			GrantId:   grantId,
+			Hashed:    hashedRefresh,
+			Refresh:   true,
+			Scopes:    scopes,
+			ExpiredAt: refreshExpiredAt,
+		},
+	}).Error
+}
+
+// tokens are issued only under grant, return gorm.ErrRecordNotFound if grant is revoked
+func (d *DB) CreateOAuthTokens(claimer *claimer.Claimer, oauthClientId uint64, scopes string, hashedAccess []byte, hashedRefresh []byte, accessExpiredAt time.Time, refreshExpiredAt time.Time) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		grant := &model.OAuthGrant{}
+		if err := tx.
+			Select("id").
+			Where("user_id = ? AND o_auth_client_id = ?", claimerId, oauthClientId).
+			First(grant).Error; err != nil {
+			return err
+		}
+		return createOAuthTokenPair(tx, grant.Id, scopes, hashedAccess, hashedRefresh, accessExpiredAt, refreshExpiredAt)
+	})
+}
+
+// refresh token is single use, new pair keeps scopes of previous pair, return scopes
+func (d *DB) RotateOAuthRefreshToken(oauthClientId uint64, hashedRefresh []byte, hashedAccess []byte, newHashedRefresh []byte, accessExpiredAt time.Time, refreshExpiredAt time.Time) (string, error) {
+	token := &model.OAuthToken{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Select("o_auth_tokens.id", "o_auth_tokens.grant_id", "o_auth_tokens.scopes", "o_auth_tokens.expired_at").
+			Joins("INNER JOIN o_auth_grants ON o_auth_grants.id = o_auth_tokens.grant_id").
+			Where("o_auth_tokens.hashed = ? AND o_auth_tokens.refresh = ? AND o_auth_grants.o_auth_client_id = ?", hashedRefresh, true, oauthClientId).
+			First(token).Error; err != nil {
+			return err
+		}
+		if token.ExpiredAt.Before(time.Now()) {
+			return ErrOAuthTokenExpired
+		}
+		result := tx.Delete(&model.OAuthToken{}, token.Id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoAffectedRow
+		}
+		return createOAuthTokenPair(tx, token.GrantId, token.Scopes, hashedAccess, newHashedRefresh, accessExpiredAt, refreshExpiredAt)
+	})
+	if err != nil {
+		return "", err
+	}
+	return token.Scopes, nil
+}
+
+type oauthTokenOwner struct {
+	AuthUUID  binaryuuid.UUID
+	Scopes    string
+	ExpiredAt time.Time
+}
+
+// find owner and scopes of access token
+func (d *DB) UseOAuthAccessToken(hashed []byte) (*claimer.Claimer, string, error) {
+	owner := &oauthTokenOwner{}
+	if err := d.DB.
+		Model(&model.OAuthToken{}).
+		Select("users.auth_uuid", "o_auth_tokens.scopes", "o_auth_tokens.expired_at").
+		Joins("INNER JOIN o_auth_grants ON o_auth_grants.id = o_auth_tokens.grant_id").
+		Joins("INNER JOIN users ON users.id = o_auth_grants.user_id").
+		Where("o_auth_tokens.hashed = ? AND o_auth_tokens.refresh = ?", hashed, false).
+		First(owner).Error; err != nil {
+		return nil, "", err
+	}
+	if owner.ExpiredAt.Before(time.Now()) {
+		return nil, "", ErrOAuthTokenExpired
+	}
+	return claimer.New(&owner.AuthUUID), owner.Scopes, nil
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"github.com/capdale/was/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestOAuthGrant() {
+	owner := s.MustCreateAccount()
+	user := s.MustCreateAccount()
+
+	client := &model.OAuthClient{
+		ClientId:     "test-client",
+		Name:         "test app",
+		RedirectURIs: "https://app.test/callback",
+		Scopes:       "collection:read article:read",
+	}
+	err := s.d.CreateOAuthClient(owner.Claim, client)
+	assert.Nil(s.T(), err)
+
+	clients, err := s.d.GetOAuthClients(owner.Claim)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), *clients, 1)
+	assert.False(s.T(), (*clients)[0].Confidential)
+
+	access := sha256.Sum256([]byte("access token"))
+	refresh := sha256.Sum256([]byte("refresh token"))
+	now := time.Now()
+
+	// tokens need consent of user
+	err = s.d.CreateOAuthTokens(user.Claim, client.Id, "collection:read", access[:], refresh[:], now.Add(time.Hour), now.Add(time.Hour))
+	assert.NotNil(s.T(), err)
+
+	err = s.d.SaveOAuthGrant(user.Claim, client.Id, "collection:read")
+	assert.Nil(s.T(), err)
+	err = s.d.SaveOAuthGrant(user.Claim, client.Id, "collection:read article:read")
+	assert.Nil(s.T(), err)
+	grants, err := s.d.GetOAuthGrants(user.Claim)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), *grants, 1)
+	assert.Equal(s.T(), "test-client", (*grants)[0].ClientId)
+	assert.Equal(s.T(), "collection:read article:read", (*grants)[0].Scopes)
+
+	err = s.d.CreateOAuthTokens(user.Claim, client.Id, "collection:read", access[:], refresh[:], now.Add(time.Hour), now.Add(time.Hour))
+	assert.Nil(s.T(), err)
+
+	claimer, scopes, err := s.d.UseOAuthAccessToken(access[:])
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), *user.Claim, *claimer)
+	assert.Equal(s.T(), "collection:read", scopes)
+
+	// refresh token is not access token
+	_, _, err = s.d.UseOAuthAccessToken(refresh[:])
+	assert.NotNil(s.T(), err)
+
+	newAccess := sha256.Sum256([]byte("new access token"))
+	newRefresh := sha256.Sum256([]byte("new refresh token"))
+	scopes, err = s.d.RotateOAuthRefreshToken(client.Id, refresh[:], newAccess[:], newRefresh[:], now.Add(time.Hour), now.Add(time.Hour))
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), "collection:read", scopes)
+
+	// refresh token is single use
+	_, err = s.d.RotateOAuthRefreshToken(client.Id, refresh[:], newAccess[:], newRefresh[:], now.Add(time.Hour), now.Add(time.Hour))
+	assert.NotNil(s.T(), err)
+
+	// revoked grant remove every token
+	err = s.d.DeleteOAuthGrant(user.Claim, "test-client")
+	assert.Nil(s.T(), err)
+	_, _, err = s.d.UseOAuthAccessToken(newAccess[:])
+	assert.NotNil(s.T(), err)
+	grants, _ = s.d.GetOAuthGrants(user.Claim)
+	assert.Len(s.T(), *grants, 0)
+
+	// client of other user cannot be deleted
+	err = s.d.DeleteOAuthClient(user.Claim, "test-client")
+	assert.NotNil(s.T(), err)
+	err = s.d.DeleteOAuthClient(owner.Claim, "test-client")
+	assert.Nil(s.T(), err)
+}
+
+func (s *DatabaseSuite) TestOAuthTokenExpired() {
+	owner := s.MustCreateAccount()
+	client := &model.OAuthClient{
+		ClientId:     "expired-client",
+		Name:         "test app",
+		RedirectURIs: "https://app.test/callback",
+		Scopes:       "collection:read",
+	}
+	assert.Nil(s.T(), s.d.CreateOAuthClient(owner.Claim, client))
+	assert.Nil(s.T(), s.d.SaveOAuthGrant(owner.Claim, client.Id, "collection:read"))
+
+	access := sha256.Sum256([]byte("expired access token"))
+	refresh := sha256.Sum256([]byte("expired refresh token"))
+	past := time.Now().Add(-time.Minute)
+	err := s.d.CreateOAuthTokens(owner.Claim, client.Id, "collection:read", access[:], refresh[:], past, past)
+	assert.Nil(s.T(), err)
+
+	_, _, err = s.d.UseOAuthAccessToken(access[:])
+	assert.ErrorIs(s.T(), err, ErrOAuthTokenExpired)
+	_, err = s.d.RotateOAuthRefreshToken(client.Id, refresh[:], access[:], refresh[:], time.Now(), time.Now())
+	assert.ErrorIs(s.T(), err, ErrOAuthTokenExpired)
+}
@@ -0,0 +1,125 @@
+package database
+
+import (
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+// only user with password can reset password, return ErrNoUserExist if there is no such user with email
+func (d *DB) CreatePasswordResetTicket(email string) (*binaryuuid.UUID, error) {
+	if err := d.DB.
+		Joins("INNER JOIN origin_users ON origin_users.id = users.id").
+		Where("email = ?", email).
+		First(&model.User{}).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrNoUserExist
+		}
+		return nil, err
+	}
+
+	ticket := &model.Ticket{
+		Email: email,
+		Type:  model.TicketTypePasswordReset,
+	}
+	if err := d.DB.Create(ticket).Error; err != nil {
+		return nil, err
+	}
+	return &ticket.UUID, nil
+}
+
+func (d *DB) GetEmailByPasswordResetTicket(ticketUUID *binaryuuid.UUID) (string, error) {
+	ticket, err := d.getTicket(ticketUUID, model.TicketTypePasswordReset)
+	if err != nil {
+		return "", err
+	}
+	return ticket.Email, nil
+}
+
+// set new password and remove every refresh token of user, return claimer of user to revoke access tokens
+func (d *DB) ResetPasswordViaTicket(ticketUUID *binaryuuid.UUID, password string) (*claimer.Claimer, error) {
+	hashed, err := d.hasher.Hash(password)
+	if err != nil {
+		return nil, err
+	}
+
+	ticket, err := d.getTicket(ticketUUID, model.TicketTypePasswordReset)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{}
+	err = d.DB.Transaction(func(tx *gorm.DB) error {
+		// ticket is single use
+		result := tx.
+			Where("uuid = ? AND type = ?", ticket.UUID, model.TicketTypePasswordReset).
+			Delete(&model.Ticket{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoAffectedRow
+		}
+
+		if err := tx.
+			Select("users.id", "users.auth_uuid").
+			Joins("INNER JOIN origin_users ON origin_users.id = users.id").
+			Where("email = ?", ticket.Email).
+			First(user).Error; err != nil {
+			return err
+		}
+
+		if err := tx.
+			Model(&model.OriginUser{}).
+			Where("id = ?", user.Id).
+			Update("hashed", hashed).Error; err != nil {
+			return err
+		}
+
+		return tx.
+			Where("user_id = ?", user.Id).
+			Delete(&model.Token{}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimer.New(&user.AuthUUID), nil
+}
+
+func (d *DB) VerifyPassword(claimer *claimer.Claimer, password string) (bool, error) {
+	user := &userClaimdNhashed{}
+	if err := d.DB.
+		Model(&model.User{}).
+		Select("users.id", "users.auth_uuid", "origin_users.hashed").
+		Joins("INNER JOIN origin_users ON origin_users.id = users.id").
+		Where("auth_uuid = ?", claimer).
+		First(user).Error; err != nil {
+		return false, err
+	}
+	return d.verifyPassword(user, password)
+}
+
+func (d *DB) ChangePassword(claimer *claimer.Claimer, password string) error {
+	hashed, err := d.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		result := tx.
+			Model(&model.OriginUser{}).
+			Where("id = ?", claimerId).
+			Update("hashed", hashed)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoAffectedRow
+		}
+		return nil
+	})
+}
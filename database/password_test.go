@@ -0,0 +1,104 @@
+package database
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/capdale/was/auth/passhash"
+	"github.com/capdale/was/config"
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/test"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func (s *DatabaseSuite) TestResetPassword() {
+	user := s.MustCreateAccount()
+	s.mustCreateSession(user)
+
+	_, err := s.d.CreatePasswordResetTicket("notexist@test.test")
+	assert.ErrorIs(s.T(), err, ErrNoUserExist)
+
+	ticket, err := s.d.CreatePasswordResetTicket(user.Email)
+	assert.Nil(s.T(), err)
+
+	// reset ticket cannot be used for register
+	_, err = s.d.GetEmailByTicket(ticket)
+	assert.NotNil(s.T(), err)
+
+	email, err := s.d.GetEmailByPasswordResetTicket(ticket)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), user.Email, email)
+
+	newPassword := "Newpassword1234!@"
+	claimer, err := s.d.ResetPasswordViaTicket(ticket, newPassword)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), *user.Claim, *claimer)
+
+	_, err = s.loginAccount(user.Username, user.Password)
+	assert.NotNil(s.T(), err)
+	_, err = s.loginAccount(user.Username, newPassword)
+	assert.Nil(s.T(), err)
+
+	tokens, _ := s.d.QueryAllTokensByClaimer(user.Claim)
+	assert.Len(s.T(), *tokens, 0)
+
+	// ticket is single use
+	_, err = s.d.ResetPasswordViaTicket(ticket, newPassword)
+	assert.NotNil(s.T(), err)
+}
+
+func (s *DatabaseSuite) TestChangePassword() {
+	user := s.MustCreateAccount()
+
+	ok, err := s.d.VerifyPassword(user.Claim, "Wrongpassword1234!@")
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), ok)
+	ok, err = s.d.VerifyPassword(user.Claim, user.Password)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), ok)
+
+	newPassword := "Newpassword1234!@"
+	err = s.d.ChangePassword(user.Claim, newPassword)
+	assert.Nil(s.T(), err)
+	_, err = s.loginAccount(user.Username, newPassword)
+	assert.Nil(s.T(), err)
+}
+
+func (s *DatabaseSuite) TestLegacyPasswordRehash() {
+	user := s.MustCreateAccount()
+	userId, err := s.d.GetUserIdByClaimer(user.Claim)
+	assert.Nil(s.T(), err)
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.MinCost)
+	err = s.d.DB.Model(&model.OriginUser{}).Where("id = ?", userId).Update("hashed", legacy).Error
+	assert.Nil(s.T(), err)
+
+	_, err = s.loginAccount(user.Username, "Wrongpassword1234!@")
+	assert.ErrorIs(s.T(), err, ErrPasswordMismatch)
+
+	// legacy hash is verified, then upgraded to argon2id
+	claimer, err := s.loginAccount(user.Username, user.Password)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), *user.Claim, *claimer)
+
+	origin := &model.OriginUser{}
+	err = s.d.DB.Where("id = ?", userId).First(origin).Error
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), bytes.HasPrefix(origin.Hashed, []byte("$argon2id$")))
+
+	_, err = s.loginAccount(user.Username, user.Password)
+	assert.Nil(s.T(), err)
+}
+
+func TestWeakArgon2Config(t *testing.T) {
+	tmpDir := test.NewTmpDir("was_database")
+	defer tmpDir.Close()
+
+	_, err := New(&config.Database{
+		SQLite: &config.SQLite{Path: tmpDir.Join("test.db")},
+		Argon2: &config.Argon2{Memory: 64 * 1024, Iterations: 3, Parallelism: 0},
+	}, math.MaxInt)
+	assert.ErrorIs(t, err, passhash.ErrWeakParams)
+}
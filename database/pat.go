@@ -0,0 +1,109 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+var ErrPersonalAccessTokenExpired = errors.New("personal access token expired")
+
+func (d *DB) CreatePersonalAccessToken(claimer *claimer.Claimer, name string, hashed []byte, scopes string, expiredAt *time.Time) (*model.PersonalAccessTokenAPI, error) {
+	token := &model.PersonalAccessToken{
+		Name:      name,
+		Hashed:    hashed,
+		Scopes:    scopes,
+		ExpiredAt: expiredAt,
+	}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		token.UserId = claimerId
+		return tx.Create(token).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &model.PersonalAccessTokenAPI{
+		Id:        token.Id,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt,
+		ExpiredAt: token.ExpiredAt,
+	}, nil
+}
+
+func (d *DB) GetPersonalAccessTokens(claimer *claimer.Claimer) (*[]*model.PersonalAccessTokenAPI, error) {
+	tokens := []*model.PersonalAccessTokenAPI{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		return tx.
+			Model(&model.PersonalAccessToken{}).
+			Select("id", "name", "scopes", "created_at", "expired_at", "last_used_at").
+			Where("user_id = ?", claimerId).
+			Find(&tokens).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &tokens, nil
+}
+
+func (d *DB) DeletePersonalAccessToken(claimer *claimer.Claimer, tokenId uint64) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		result := tx.
+			Where("id = ? AND user_id = ?", tokenId, claimerId).
+			Delete(&model.PersonalAccessToken{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoAffectedRow
+		}
+		return nil
+	})
+}
+
+type personalAccessTokenOwner struct {
+	Id        uint64
+	AuthUUID  binaryuuid.UUID
+	Scopes    string
+	ExpiredAt *time.Time
+}
+
+// find owner and scopes of token, last used time is updated
+func (d *DB) UsePersonalAccessToken(hashed []byte) (*claimer.Claimer, string, error) {
+	owner := &personalAccessTokenOwner{}
+	if err := d.DB.
+		Model(&model.PersonalAccessToken{}).
+		Select("personal_access_tokens.id", "users.auth_uuid", "personal_access_tokens.scopes", "personal_access_tokens.expired_at").
+		Joins("INNER JOIN users ON users.id = personal_access_tokens.user_id").
+		Where("personal_access_tokens.hashed = ?", hashed).
+		First(owner).Error; err != nil {
+		return nil, "", err
+	}
+	if owner.ExpiredAt != nil && owner.ExpiredAt.Before(time.Now()) {
+		return nil, "", ErrPersonalAccessTokenExpired
+	}
+
+	if err := d.DB.
+		Model(&model.PersonalAccessToken{}).
+		Where("id = ?", owner.Id).
+		Update("last_used_at", time.Now()).Error; err != nil {
+		return nil, "", err
+	}
+	return claimer.New(&owner.AuthUUID), owner.Scopes, nil
+}
@@ -0,0 +1,42 @@
+package database
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestPersonalAccessToken() {
+	user := s.MustCreateAccount()
+	other := s.MustCreateAccount()
+
+	hashed := sha256.Sum256([]byte("personal access token"))
+	token, err := s.d.CreatePersonalAccessToken(user.Claim, "upload script", hashed[:], "collection:write", nil)
+	assert.Nil(s.T(), err)
+
+	claimer, scopes, err := s.d.UsePersonalAccessToken(hashed[:])
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), *user.Claim, *claimer)
+	assert.Equal(s.T(), "collection:write", scopes)
+
+	expired := time.Now().Add(-time.Minute)
+	expiredHashed := sha256.Sum256([]byte("expired personal access token"))
+	_, err = s.d.CreatePersonalAccessToken(user.Claim, "expired", expiredHashed[:], "article:read", &expired)
+	assert.Nil(s.T(), err)
+	_, _, err = s.d.UsePersonalAccessToken(expiredHashed[:])
+	assert.ErrorIs(s.T(), err, ErrPersonalAccessTokenExpired)
+
+	tokens, err := s.d.GetPersonalAccessTokens(user.Claim)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), *tokens, 2)
+
+	// token of other user cannot be deleted
+	err = s.d.DeletePersonalAccessToken(other.Claim, token.Id)
+	assert.ErrorIs(s.T(), err, ErrNoAffectedRow)
+
+	err = s.d.DeletePersonalAccessToken(user.Claim, token.Id)
+	assert.Nil(s.T(), err)
+	_, _, err = s.d.UsePersonalAccessToken(hashed[:])
+	assert.NotNil(s.T(), err)
+}
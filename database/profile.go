@@ -0,0 +1,102 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+var ErrUsernameAlreadyUsed = errors.New("username already used")
+
+func (d *DB) IsUsernameUsed(username string) (bool, error) {
+	if err := d.DB.
+		Where("username = ?", username).
+		First(&model.User{}).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return true, err
+	}
+	return true, nil
+}
+
+func (d *DB) GetUserProfile(claimer *claimer.Claimer) (*model.UserProfileAPI, error) {
+	user := &model.User{}
+	profile := &model.UserProfileAPI{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Preload("UserDisplayType").
+			Preload("SocialUser").
+			Where("auth_uuid = ?", claimer).
+			First(user).Error; err != nil {
+			return err
+		}
+
+		accountType := model.AccountTypeOrigin
+		if user.SocialUser != nil {
+			accountType = user.SocialUser.AccountType
+		}
+		profile.Username = user.Username
+		profile.Email = user.Email
+		profile.AccountType = model.AccountTypeName(accountType)
+		profile.Role = user.Role
+		profile.IsPrivate = user.UserDisplayType != nil && user.UserDisplayType.IsPrivate
+		profile.CreatedAt = user.CreatedAt
+
+		if err := tx.
+			Model(&model.UserFollow{}).
+			Where("target_id = ?", user.Id).
+			Count(&profile.Followers).Error; err != nil {
+			return err
+		}
+		return tx.
+			Model(&model.UserFollow{}).
+			Where("user_id = ?", user.Id).
+			Count(&profile.Followings).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// nil field is not changed
+func (d *DB) UpdateUserProfile(claimer *claimer.Claimer, username *string, isPrivate *bool) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+
+		if username != nil {
+			var count int64
+			if err := tx.
+				Model(&model.User{}).
+				Where("username = ? AND id <> ?", username, claimerId).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrUsernameAlreadyUsed
+			}
+			if err := tx.
+				Model(&model.User{}).
+				Where("id = ?", claimerId).
+				Update("username", username).Error; err != nil {
+				return err
+			}
+		}
+
+		if isPrivate != nil {
+			if err := tx.
+				Model(&model.UserDisplayType{}).
+				Where("user_id = ?", claimerId).
+				Update("is_private", isPrivate).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
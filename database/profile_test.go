@@ -0,0 +1,35 @@
+package database
+
+import (
+	"github.com/capdale/was/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestUserProfile() {
+	user := s.MustCreateAccount()
+	other := s.MustCreateAccount()
+	s.d.RequestFollow(other.Claim, &user.Username)
+
+	profile, err := s.d.GetUserProfile(user.Claim)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), user.Username, profile.Username)
+	assert.Equal(s.T(), user.Email, profile.Email)
+	assert.Equal(s.T(), "origin", profile.AccountType)
+	assert.Equal(s.T(), model.RoleUser, profile.Role)
+	assert.False(s.T(), profile.IsPrivate)
+	assert.Equal(s.T(), int64(1), profile.Followers)
+	assert.Equal(s.T(), int64(0), profile.Followings)
+
+	// username of other user cannot be used
+	err = s.d.UpdateUserProfile(user.Claim, &other.Username, nil)
+	assert.ErrorIs(s.T(), err, ErrUsernameAlreadyUsed)
+
+	newUsername := user.Username + "new"
+	isPrivate := true
+	err = s.d.UpdateUserProfile(user.Claim, &newUsername, &isPrivate)
+	assert.Nil(s.T(), err)
+
+	profile, _ = s.d.GetUserProfile(user.Claim)
+	assert.Equal(s.T(), newUsername, profile.Username)
+	assert.True(s.T(), profile.IsPrivate)
+}
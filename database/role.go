@@ -0,0 +1,69 @@
+package database
+
+import (
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+func (d *DB) GetUserRole(claimer *claimer.Claimer) (string, error) {
+	user := &model.User{}
+	if err := d.DB.
+		Select("role").
+		Where("auth_uuid = ?", claimer).
+		First(user).Error; err != nil {
+		return "", err
+	}
+	return user.Role, nil
+}
+
+// return claimer of user to revoke tokens issued with previous role
+func (d *DB) SetUserRole(username string, role string) (*claimer.Claimer, error) {
+	user := &model.User{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.
+			Select("id", "auth_uuid").
+			Where("username = ?", username).
+			First(user).Error; err != nil {
+			return err
+		}
+		return tx.
+			Model(&model.User{}).
+			Where("id = ?", user.Id).
+			Update("role", role).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimer.New(&user.AuthUUID), nil
+}
+
+// promote user to admin only if there is no admin, false if admin already exists
+func (d *DB) BootstrapAdmin(username string) (bool, error) {
+	promoted := false
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.
+			Model(&model.User{}).
+			Where("role = ?", model.RoleAdmin).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		result := tx.
+			Model(&model.User{}).
+			Where("username = ?", username).
+			Update("role", model.RoleAdmin)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoUserExist
+		}
+		promoted = true
+		return nil
+	})
+	return promoted, err
+}
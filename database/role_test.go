@@ -0,0 +1,37 @@
+package database
+
+import (
+	"github.com/capdale/was/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestRole() {
+	user := s.MustCreateAccount()
+	other := s.MustCreateAccount()
+
+	role, err := s.d.GetUserRole(user.Claim)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), model.RoleUser, role)
+
+	_, err = s.d.BootstrapAdmin("notexistuser")
+	assert.ErrorIs(s.T(), err, ErrNoUserExist)
+
+	promoted, err := s.d.BootstrapAdmin(user.Username)
+	assert.Nil(s.T(), err)
+	assert.True(s.T(), promoted)
+	role, _ = s.d.GetUserRole(user.Claim)
+	assert.Equal(s.T(), model.RoleAdmin, role)
+
+	// bootstrap only works without admin
+	promoted, err = s.d.BootstrapAdmin(other.Username)
+	assert.Nil(s.T(), err)
+	assert.False(s.T(), promoted)
+
+	claimer, err := s.d.SetUserRole(other.Username, model.RoleModerator)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), *other.Claim, *claimer)
+	role, _ = s.d.GetUserRole(other.Claim)
+	assert.Equal(s.T(), model.RoleModerator, role)
+
+	s.d.SetUserRole(user.Username, model.RoleUser)
+}
@@ -7,7 +7,6 @@ import (
 	"github.com/capdale/was/model"
 	"github.com/capdale/was/types/binaryuuid"
 	"github.com/capdale/was/types/claimer"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -15,6 +14,7 @@ var (
 	ErrNoUserExist      = errors.New("no user exists")
 	ErrTicketExpired    = errors.New("ticket expired")
 	ErrEmailAlreadyUsed = errors.New("email already used")
+	ErrPasswordMismatch = model.ErrPasswordMismatch // api matches it without database package
 )
 
 // func (d *DB) ExchangeIDs2Names(ids *[]uint64) (*[]string, error) {
@@ -41,30 +41,16 @@ func (d *DB) GetUserByEmail(email string) (user *model.User, err error) {
 	return
 }
 
-func (d *DB) CreateWithGithub(username string, email string) (*model.User, error) {
+// create social user, identity is first login method of user
+func (d *DB) CreateWithIdentity(username string, identity *model.Identity) (*model.User, error) {
 	user := &model.User{
 		Username:    username,
-		Email:       email,
-		AccountType: model.AccountTypeGithub,
+		Email:       identity.Email,
+		AccountType: identity.AccountType,
 		SocialUser: &model.SocialUser{
-			AccountType: model.AccountTypeGithub,
-		},
-		UserDisplayType: &model.UserDisplayType{
-			IsPrivate: false,
-		},
-	}
-	err := d.DB.Create(user).Error
-	return user, err
-}
-
-func (d *DB) CreateWithKakao(username string, email string) (*model.User, error) {
-	user := &model.User{
-		Username:    username,
-		Email:       email,
-		AccountType: model.AccountTypeKakao,
-		SocialUser: &model.SocialUser{
-			AccountType: model.AccountTypeKakao,
+			AccountType: identity.AccountType,
 		},
+		Identities: &[]*model.Identity{identity},
 		UserDisplayType: &model.UserDisplayType{
 			IsPrivate: false,
 		},
@@ -90,7 +76,11 @@ func getUserIdByName(tx *gorm.DB, username *string) (uint64, error) {
 }
 
 func (d *DB) IsEmailUsed(email string) (bool, error) {
-	if err := d.DB.
+	return isEmailUsed(d.DB, email)
+}
+
+func isEmailUsed(tx *gorm.DB, email string) (bool, error) {
+	if err := tx.
 		Where("email = ?", email).
 		First(&model.User{}).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
@@ -138,9 +128,13 @@ func (d *DB) IsTicketAvailable(ticketUUID *binaryuuid.UUID) (bool, error) {
 }
 
 func (d *DB) GetTicket(ticketUUID *binaryuuid.UUID) (*model.Ticket, error) {
+	return d.getTicket(ticketUUID, model.TicketTypeRegister)
+}
+
+func (d *DB) getTicket(ticketUUID *binaryuuid.UUID, ticketType uint8) (*model.Ticket, error) {
 	ticket := &model.Ticket{}
 	if err := d.DB.
-		Where("uuid = ?", ticketUUID).
+		Where("uuid = ? AND type = ?", ticketUUID, ticketType).
 		First(ticket).Error; err != nil {
 		return nil, err
 	}
@@ -161,7 +155,7 @@ func (d *DB) GetEmailByTicket(ticketUUID *binaryuuid.UUID) (string, error) {
 }
 
 func (d *DB) CreateOriginViaTicket(ticketUUID *binaryuuid.UUID, username string, password string) error {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashed, err := d.hasher.Hash(password)
 	if err != nil {
 		return err
 	}
@@ -197,24 +191,64 @@ func (d *DB) CreateOriginViaTicket(ticketUUID *binaryuuid.UUID, username string,
 	})
 }
 
+func (d *DB) GetOriginEmailByUsername(username string) (string, error) {
+	user := &model.User{}
+	if err := d.DB.
+		Select("users.email").
+		Joins("INNER JOIN origin_users ON origin_users.id = users.id").
+		Where("username = ?", username).
+		First(user).Error; err != nil {
+		return "", err
+	}
+	return user.Email, nil
+}
+
 type userClaimdNhashed struct {
+	Id       uint64
 	AuthUUID binaryuuid.UUID
 	Hashed   []byte
 }
 
+// legacy (bcrypt) or outdated hash is replaced with current params on successful verify, no password reset needed
+func (d *DB) verifyPassword(user *userClaimdNhashed, password string) (bool, error) {
+	match, rehash, err := d.hasher.Verify(user.Hashed, password)
+	if err != nil || !match {
+		return false, err
+	}
+	if !rehash {
+		return true, nil
+	}
+	hashed, err := d.hasher.Hash(password)
+	if err != nil {
+		return false, err
+	}
+	// compare old hash, password can be changed by other request meanwhile
+	if err := d.DB.
+		Model(&model.OriginUser{}).
+		Where("id = ? AND hashed = ?", user.Id, user.Hashed).
+		Update("hashed", hashed).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (d *DB) GetOriginUserClaim(username string, password string) (*claimer.Claimer, error) {
 	user := &userClaimdNhashed{}
 	if err := d.DB.
 		Model(&model.User{}).
-		Select("users.auth_uuid", "origin_users.hashed").
+		Select("users.id", "users.auth_uuid", "origin_users.hashed").
 		Joins("INNER JOIN origin_users ON origin_users.id = users.id").
-		Where("username = ? AND account_type = ?", username, model.AccountTypeOrigin).
+		Where("username = ?", username).
 		First(user).Error; err != nil {
 		return nil, err
 	}
-	if err := bcrypt.CompareHashAndPassword(user.Hashed, []byte(password)); err != nil {
+	match, err := d.verifyPassword(user, password)
+	if err != nil {
 		return nil, err
 	}
+	if !match {
+		return nil, ErrPasswordMismatch
+	}
 	claimer := claimer.New(&user.AuthUUID)
 	return claimer, nil
 }
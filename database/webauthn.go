@@ -0,0 +1,101 @@
+package database
+
+import (
+	"time"
+
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/capdale/was/types/claimer"
+	"gorm.io/gorm"
+)
+
+func getWebauthnCredentials(tx *gorm.DB, userId uint64) (*[]*model.WebauthnCredential, error) {
+	credentials := []*model.WebauthnCredential{}
+	if err := tx.
+		Where("user_id = ?", userId).
+		Find(&credentials).Error; err != nil {
+		return nil, err
+	}
+	return &credentials, nil
+}
+
+// user and registered credentials
+func (d *DB) GetWebauthnUser(claimer *claimer.Claimer) (*model.User, *[]*model.WebauthnCredential, error) {
+	user := &model.User{}
+	if err := d.DB.
+		Select("id", "username", "auth_uuid").
+		Where("auth_uuid = ?", claimer).
+		First(user).Error; err != nil {
+		return nil, nil, err
+	}
+	credentials, err := getWebauthnCredentials(d.DB, user.Id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, credentials, nil
+}
+
+// user handle is auth uuid of user
+func (d *DB) GetWebauthnUserByHandle(userHandle *binaryuuid.UUID) (*model.User, *[]*model.WebauthnCredential, error) {
+	return d.GetWebauthnUser(claimer.New(userHandle))
+}
+
+func (d *DB) CreateWebauthnCredential(claimer *claimer.Claimer, credential *model.WebauthnCredential) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		credential.UserId = claimerId
+		return tx.Create(credential).Error
+	})
+}
+
+func (d *DB) UpdateWebauthnCredentialUsed(credentialId []byte, signCount uint32, backupState bool) error {
+	return d.DB.
+		Model(&model.WebauthnCredential{}).
+		Where("credential_id = ?", credentialId).
+		Updates(map[string]interface{}{
+			"sign_count":   signCount,
+			"backup_state": backupState,
+			"last_used_at": time.Now(),
+		}).Error
+}
+
+func (d *DB) GetWebauthnCredentials(claimer *claimer.Claimer) (*[]*model.WebauthnCredentialAPI, error) {
+	credentials := []*model.WebauthnCredentialAPI{}
+	err := d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		return tx.
+			Model(&model.WebauthnCredential{}).
+			Select("id", "created_at", "last_used_at").
+			Where("user_id = ?", claimerId).
+			Find(&credentials).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &credentials, nil
+}
+
+func (d *DB) DeleteWebauthnCredential(claimer *claimer.Claimer, credentialId uint64) error {
+	return d.DB.Transaction(func(tx *gorm.DB) error {
+		claimerId, err := getUserIdByClaimer(tx, claimer)
+		if err != nil {
+			return err
+		}
+		result := tx.
+			Where("id = ? AND user_id = ?", credentialId, claimerId).
+			Delete(&model.WebauthnCredential{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrNoAffectedRow
+		}
+		return nil
+	})
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"github.com/capdale/was/model"
+	"github.com/capdale/was/types/binaryuuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func (s *DatabaseSuite) TestWebauthnCredential() {
+	user := s.MustCreateAccount()
+	other := s.MustCreateAccount()
+
+	credential := &model.WebauthnCredential{
+		CredentialId: []byte("credential id"),
+		PublicKey:    []byte("public key"),
+	}
+	err := s.d.CreateWebauthnCredential(user.Claim, credential)
+	assert.Nil(s.T(), err)
+
+	handle := binaryuuid.UUID(*user.Claim)
+	u, credentials, err := s.d.GetWebauthnUserByHandle(&handle)
+	assert.Nil(s.T(), err)
+	assert.Equal(s.T(), user.Username, u.Username)
+	assert.Len(s.T(), *credentials, 1)
+
+	err = s.d.UpdateWebauthnCredentialUsed(credential.CredentialId, 3, true)
+	assert.Nil(s.T(), err)
+	_, credentials, _ = s.d.GetWebauthnUser(user.Claim)
+	assert.Equal(s.T(), uint32(3), (*credentials)[0].SignCount)
+	assert.NotNil(s.T(), (*credentials)[0].LastUsedAt)
+
+	// credential of other user cannot be deleted
+	err = s.d.DeleteWebauthnCredential(other.Claim, credential.Id)
+	assert.ErrorIs(s.T(), err, ErrNoAffectedRow)
+
+	apiCredentials, err := s.d.GetWebauthnCredentials(user.Claim)
+	assert.Nil(s.T(), err)
+	assert.Len(s.T(), *apiCredentials, 1)
+
+	err = s.d.DeleteWebauthnCredential(user.Claim, credential.Id)
+	assert.Nil(s.T(), err)
+	_, credentials, _ = s.d.GetWebauthnUser(user.Claim)
+	assert.Len(s.T(), *credentials, 0)
+}
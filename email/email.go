@@ -5,12 +5,19 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/capdale/was/config"
 )
 
 type EmailService interface {
 	SendTicketVerifyLink(ctx context.Context, email string, link string) error
+	SendPasswordResetLink(ctx context.Context, email string, link string) error
+	SendEmailChangeLink(ctx context.Context, email string, link string) error
+	SendMagicLink(ctx context.Context, email string, link string) error
+	SendEmailChangeNotice(ctx context.Context, email string, newEmail string) error
+	SendAccountLockedNotice(ctx context.Context, email string, lockout time.Duration) error
+	SendNewDeviceNotice(ctx context.Context, email string, device string) error
 }
 
 type EmailMock struct {
@@ -31,6 +38,48 @@ func (m *EmailMock) SendTicketVerifyLink(ctx context.Context, email string, link
 	return nil
 }
 
+func (m *EmailMock) SendPasswordResetLink(ctx context.Context, email string, link string) error {
+	if m.logtype == "cli" {
+		fmt.Println(link)
+	}
+	return nil
+}
+
+func (m *EmailMock) SendEmailChangeLink(ctx context.Context, email string, link string) error {
+	if m.logtype == "cli" {
+		fmt.Println(link)
+	}
+	return nil
+}
+
+func (m *EmailMock) SendMagicLink(ctx context.Context, email string, link string) error {
+	if m.logtype == "cli" {
+		fmt.Println(link)
+	}
+	return nil
+}
+
+func (m *EmailMock) SendEmailChangeNotice(ctx context.Context, email string, newEmail string) error {
+	if m.logtype == "cli" {
+		fmt.Printf("%s -> %s\n", email, newEmail)
+	}
+	return nil
+}
+
+func (m *EmailMock) SendAccountLockedNotice(ctx context.Context, email string, lockout time.Duration) error {
+	if m.logtype == "cli" {
+		fmt.Printf("%s locked for %s\n", email, lockout)
+	}
+	return nil
+}
+
+func (m *EmailMock) SendNewDeviceNotice(ctx context.Context, email string, device string) error {
+	if m.logtype == "cli" {
+		fmt.Printf("%s signed in from %s\n", email, device)
+	}
+	return nil
+}
+
 var emailCensorExpr = regexp.MustCompile(`^[\w-\.]([\w-\.]*)@([\w-])([\w-]*)\.([\w-]+\.)*([\w-])([\w-]{1,3})$`)
 
 func CensorEmail(email string) string {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
@@ -77,3 +78,154 @@ func (a *AwsSes) SendTicketVerifyLink(ctx context.Context, email string, link st
 	})
 	return err
 }
+
+type passwordResetPayload struct {
+	ResetLink string `json:"resetlink"`
+}
+
+func (a *AwsSes) SendPasswordResetLink(ctx context.Context, email string, link string) error {
+	p := &passwordResetPayload{
+		ResetLink: link,
+	}
+
+	pbytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.client.SendTemplatedEmail(ctx, &ses.SendTemplatedEmailInput{
+		Destination: &types.Destination{
+			ToAddresses: []string{email},
+		},
+		Source:       aws.String(a.cache.noReply),
+		Template:     aws.String("PasswordResetTemplate"),
+		TemplateData: aws.String(string(pbytes)),
+	})
+	return err
+}
+
+type emailChangePayload struct {
+	VerifyLink string `json:"verifylink"`
+}
+
+func (a *AwsSes) SendEmailChangeLink(ctx context.Context, email string, link string) error {
+	p := &emailChangePayload{
+		VerifyLink: link,
+	}
+
+	pbytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.client.SendTemplatedEmail(ctx, &ses.SendTemplatedEmailInput{
+		Destination: &types.Destination{
+			ToAddresses: []string{email},
+		},
+		Source:       aws.String(a.cache.noReply),
+		Template:     aws.String("EmailChangeTemplate"),
+		TemplateData: aws.String(string(pbytes)),
+	})
+	return err
+}
+
+type magicLinkPayload struct {
+	LoginLink string `json:"loginlink"`
+}
+
+func (a *AwsSes) SendMagicLink(ctx context.Context, email string, link string) error {
+	p := &magicLinkPayload{
+		LoginLink: link,
+	}
+
+	pbytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.client.SendTemplatedEmail(ctx, &ses.SendTemplatedEmailInput{
+		Destination: &types.Destination{
+			ToAddresses: []string{email},
+		},
+		Source:       aws.String(a.cache.noReply),
+		Template:     aws.String("MagicLinkTemplate"),
+		TemplateData: aws.String(string(pbytes)),
+	})
+	return err
+}
+
+type emailChangeNoticePayload struct {
+	NewEmail string `json:"newemail"`
+}
+
+// notice to previous email, new email is censored
+func (a *AwsSes) SendEmailChangeNotice(ctx context.Context, email string, newEmail string) error {
+	p := &emailChangeNoticePayload{
+		NewEmail: newEmail,
+	}
+
+	pbytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.client.SendTemplatedEmail(ctx, &ses.SendTemplatedEmailInput{
+		Destination: &types.Destination{
+			ToAddresses: []string{email},
+		},
+		Source:       aws.String(a.cache.noReply),
+		Template:     aws.String("EmailChangeNoticeTemplate"),
+		TemplateData: aws.String(string(pbytes)),
+	})
+	return err
+}
+
+type accountLockedPayload struct {
+	Minutes int64 `json:"minutes"`
+}
+
+func (a *AwsSes) SendAccountLockedNotice(ctx context.Context, email string, lockout time.Duration) error {
+	p := &accountLockedPayload{
+		Minutes: int64(lockout.Round(time.Minute).Minutes()),
+	}
+
+	pbytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.client.SendTemplatedEmail(ctx, &ses.SendTemplatedEmailInput{
+		Destination: &types.Destination{
+			ToAddresses: []string{email},
+		},
+		Source:       aws.String(a.cache.noReply),
+		Template:     aws.String("AccountLockedTemplate"),
+		TemplateData: aws.String(string(pbytes)),
+	})
+	return err
+}
+
+type newDevicePayload struct {
+	Device string `json:"device"`
+}
+
+func (a *AwsSes) SendNewDeviceNotice(ctx context.Context, email string, device string) error {
+	p := &newDevicePayload{
+		Device: device,
+	}
+
+	pbytes, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.client.SendTemplatedEmail(ctx, &ses.SendTemplatedEmailInput{
+		Destination: &types.Destination{
+			ToAddresses: []string{email},
+		},
+		Source:       aws.String(a.cache.noReply),
+		Template:     aws.String("NewDeviceTemplate"),
+		TemplateData: aws.String(string(pbytes)),
+	})
+	return err
+}
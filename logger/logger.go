@@ -69,6 +69,10 @@ func (c *CTXLogger) InfoWithCTX(ctx *gin.Context, msg string, fields ...zap.Fiel
 	c.Logger.With(*FieldWithCTX(ctx)...).Info(msg, fields...)
 }
 
+func (c *CTXLogger) Warn(msg string, fields ...zap.Field) {
+	c.Logger.Warn(msg, fields...)
+}
+
 func (c *CTXLogger) Error(msg string, fields ...zap.Field) {
 	c.Logger.Error(msg, fields...)
 }
@@ -3,6 +3,8 @@ package model
 import "errors"
 
 var (
-	ErrAnonymousCreate = errors.New("invalid permission, this record not allowed to create by anonymous")
-	ErrAnonymousQuery  = errors.New("invalid permission, this record not allowed query by anonymous")
+	ErrAnonymousCreate     = errors.New("invalid permission, this record not allowed to create by anonymous")
+	ErrAnonymousQuery      = errors.New("invalid permission, this record not allowed query by anonymous")
+	ErrAccountTypeConflict = errors.New("account type already registered")
+	ErrPasswordMismatch    = errors.New("password mismatch")
 )
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// third-party app registered by user, acting as oauth2 client of WAS
+type OAuthClient struct {
+	Id           uint64         `gorm:"primaryKey"`
+	ClientId     string         `gorm:"type:varchar(64);uniqueIndex;not null"`
+	OwnerId      uint64         `gorm:"index;not null"` // user who registered client
+	Name         string         `gorm:"type:varchar(64);not null"`
+	HashedSecret []byte         `gorm:"size:32"`                    // sha256 of secret, nil is public client
+	RedirectURIs string         `gorm:"type:text;not null"`         // space separated, exact match
+	Scopes       string         `gorm:"type:varchar(255);not null"` // space separated, scopes client can request
+	CreatedAt    time.Time      `gorm:"autoCreateTime"`
+	Grants       *[]*OAuthGrant `gorm:"foreignKey:OAuthClientId;references:Id;constraint:OnDelete:CASCADE"`
+}
+
+func (c *OAuthClient) BeforeCreate(tx *gorm.DB) error {
+	if c.OwnerId == 0 {
+		return ErrAnonymousCreate
+	}
+	return nil
+}
+
+type OAuthClientAPI struct {
+	ClientId     string    `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs string    `json:"redirect_uris"`
+	Scopes       string    `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// consent of user to client, tokens are removed with grant
+type OAuthGrant struct {
+	Id            uint64         `gorm:"primaryKey"`
+	UserId        uint64         `gorm:"uniqueIndex:user_client;not null"`
+	OAuthClientId uint64         `gorm:"uniqueIndex:user_client;not null"`
+	Scopes        string         `gorm:"type:varchar(255);not null"` // latest consented scopes
+	CreatedAt     time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt     time.Time      `gorm:"autoUpdateTime"`
+	Tokens        *[]*OAuthToken `gorm:"foreignKey:GrantId;references:Id;constraint:OnDelete:CASCADE"`
+}
+
+func (g *OAuthGrant) BeforeCreate(tx *gorm.DB) error {
+	if g.UserId == 0 || g.OAuthClientId == 0 {
+		return ErrAnonymousCreate
+	}
+	return nil
+}
+
+type OAuthGrantAPI struct {
+	ClientId  string    `json:"client_id"`
+	Name      string    `json:"name"`
+	Scopes    string    `json:"scopes"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// opaque access or refresh token issued to client, only hash is stored
+type OAuthToken struct {
+	Id        uint64    `gorm:"primaryKey"`
+	GrantId   uint64    `gorm:"index;not null"`
+	Hashed    []byte    `gorm:"size:32;uniqueIndex;not null"` // sha256 of token
+	Refresh   bool      `gorm:"not null;default:false"`
+	Scopes    string    `gorm:"type:varchar(255);not null"` // space separated
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	ExpiredAt time.Time `gorm:"not null"`
+}
+
+func (t *OAuthToken) BeforeCreate(tx *gorm.DB) error {
+	if t.GrantId == 0 {
+		return ErrAnonymousCreate
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"github.com/capdale/was/types/binaryuuid"
+	"gorm.io/gorm"
+)
+
+//  don't use itoa
+
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+	SecurityEventWebauthnClone     = "webauthn_clone_warning"
+	SecurityEventNewDevice         = "new_device"
+	SecurityEventImpossibleTravel  = "impossible_travel"
+)
+
+type SecurityEvent struct {
+	Id          uint64          `gorm:"primaryKey"`
+	UserId      uint64          `gorm:"index;not null"`
+	Type        string          `gorm:"type:varchar(32);not null"`
+	SessionUUID binaryuuid.UUID `gorm:"index"`
+	UserAgent   string          `gorm:"type:varchar(225)"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime"`
+}
+
+// device user logged in before, login from unknown device is alerted
+type KnownDevice struct {
+	Id         uint64    `gorm:"primaryKey"`
+	UserId     uint64    `gorm:"index;not null"`
+	UAFamily   string    `gorm:"type:varchar(64);not null"`
+	IPPrefix   string    `gorm:"type:varchar(49);not null"` // ip network, /24 or /48
+	Country    string    `gorm:"type:varchar(2)"`           // empty if geoip is not configured
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	LastSeenAt time.Time
+}
+
+func (k *KnownDevice) BeforeCreate(tx *gorm.DB) error {
+	if k.UserId == 0 {
+		return ErrAnonymousCreate
+	}
+	return nil
+}
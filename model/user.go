@@ -14,23 +14,39 @@ const (
 	AccountTypeKakao  = 2
 )
 
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
 	Id              uint64          `gorm:"primaryKey"`
 	Username        string          `gorm:"type:varchar(36);uniqueIndex:username;not null"`
 	AuthUUID        binaryuuid.UUID `gorm:"uniqueIndex;"` // this used when authentication
 	AccountType     int
-	Email           string             `gorm:"size:64;uniqueIndex;not null"`
-	CreatedAt       time.Time          `gorm:"autoCreateTime"`
-	UpdateAt        time.Time          `gorm:"autoUpdateTime"`
-	Collections     *[]Collection      `gorm:"foreignkey:UserId;references:Id;constraint:OnDelete:SET NULL;"`
-	OriginUser      *OriginUser        `gorm:"foreignkey:Id;references:Id;constraint:OnDelete:CASCADE"`
-	SocialUser      *SocialUser        `gorm:"foreignkey:Id;references:Id;constraint:OnDelete:CASCADE"`
-	UserDisplayType *UserDisplayType   `gorm:"foreignKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
-	Tokens          *[]*Token          `gorm:"foreignKey:UserId;references:Id;constraint:OnUpdate:SET NULL,OnDelete:CASCADE"`
-	UserFollowers   *[]*UserFollow     `gorm:"foreginKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
-	UserFollowings  *[]*UserFollow     `gorm:"foreginKey:TargetId;references:Id;constraint:OnDelete:CASCADE"`
-	Hearts          *[]*ArticleHeart   `gorm:"foreginKey:UserId;references:Id;constraint:OnDelete:SET NULL"`
-	ArticleComments *[]*ArticleComment `gorm:"foreginKey:UserId;references:Id;constraint:OnDelete:SET NULL"`
+	Email           string                  `gorm:"size:64;uniqueIndex;not null"`
+	Role            string                  `gorm:"type:varchar(16);not null;default:user"`
+	TokenEpoch      uint64                  `gorm:"not null;default:0"` // token issued with older epoch is invalid
+	CreatedAt       time.Time               `gorm:"autoCreateTime"`
+	UpdateAt        time.Time               `gorm:"autoUpdateTime"`
+	Collections     *[]Collection           `gorm:"foreignkey:UserId;references:Id;constraint:OnDelete:SET NULL;"`
+	OriginUser      *OriginUser             `gorm:"foreignkey:Id;references:Id;constraint:OnDelete:CASCADE"`
+	SocialUser      *SocialUser             `gorm:"foreignkey:Id;references:Id;constraint:OnDelete:CASCADE"`
+	UserDisplayType *UserDisplayType        `gorm:"foreignKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
+	Tokens          *[]*Token               `gorm:"foreignKey:UserId;references:Id;constraint:OnUpdate:SET NULL,OnDelete:CASCADE"`
+	SecurityEvents  *[]*SecurityEvent       `gorm:"foreignKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
+	KnownDevices    *[]*KnownDevice         `gorm:"foreignKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
+	RecoveryCodes   *[]*RecoveryCode        `gorm:"foreignKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
+	Webauthns       *[]*WebauthnCredential  `gorm:"foreignKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
+	AccessTokens    *[]*PersonalAccessToken `gorm:"foreignKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
+	Identities      *[]*Identity            `gorm:"foreignKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
+	OAuthClients    *[]*OAuthClient         `gorm:"foreignKey:OwnerId;references:Id;constraint:OnDelete:CASCADE"`
+	OAuthGrants     *[]*OAuthGrant          `gorm:"foreignKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
+	UserFollowers   *[]*UserFollow          `gorm:"foreginKey:UserId;references:Id;constraint:OnDelete:CASCADE"`
+	UserFollowings  *[]*UserFollow          `gorm:"foreginKey:TargetId;references:Id;constraint:OnDelete:CASCADE"`
+	Hearts          *[]*ArticleHeart        `gorm:"foreginKey:UserId;references:Id;constraint:OnDelete:SET NULL"`
+	ArticleComments *[]*ArticleComment      `gorm:"foreginKey:UserId;references:Id;constraint:OnDelete:SET NULL"`
 }
 
 func (u *User) AfterCreate(tx *gorm.DB) error {
@@ -41,8 +57,17 @@ func (u *User) AfterCreate(tx *gorm.DB) error {
 }
 
 type OriginUser struct {
-	Id     int64  `gorm:"index"`
-	Hashed []byte `gorm:"size:60;not null"`
+	Id          int64  `gorm:"index"`
+	Hashed      []byte `gorm:"size:128;not null"` // argon2id, or legacy bcrypt upgraded on login
+	TOTPSecret  []byte `gorm:"size:20"`           // set when enrollment start, valid after enabled
+	TOTPEnabled bool   `gorm:"not null;default:false"`
+	TOTPStep    int64  `gorm:"not null;default:0"` // last used step, prevent replay
+}
+
+type RecoveryCode struct {
+	Id     uint64 `gorm:"primaryKey"`
+	UserId uint64 `gorm:"index;not null"`
+	Hashed []byte `gorm:"size:32;not null"` // sha256 of code
 }
 
 type SocialUser struct {
@@ -52,14 +77,26 @@ type SocialUser struct {
 
 type Token struct {
 	// this token is same as jwt token, write when token generated, delete when token blacklist, query when refresh request comes in
-	Id           uint64          `gorm:"primaryKey"`
-	UserId       uint64          `gorm:"index;"`
-	UUID         binaryuuid.UUID `gorm:"index"` // token uuid to identify token
-	RefreshToken []byte          `gorm:"size:60;"`
-	UserAgent    string          `gorm:"type:varchar(225)"`
-	NotBefore    time.Time       // jwt expired at, refresh token cannot be used before this, also used when make jwt token
-	ExpireAt     time.Time       // refresh token expired at, after can't refresh with this
-	CreatedAt    time.Time       `gorm:"autoCreateTime"`
+	Id               uint64          `gorm:"primaryKey"`
+	UserId           uint64          `gorm:"index;"`
+	UUID             binaryuuid.UUID `gorm:"index"`               // token uuid to identify token
+	SessionUUID      binaryuuid.UUID `gorm:"index"`               // session uuid, kept through refresh, identify device, also token family of rotation
+	RefreshToken     []byte          `gorm:"size:32;uniqueIndex"` // hmac-sha256 of refresh token
+	UserAgent        string          `gorm:"type:varchar(225)"`
+	IPAddress        string          `gorm:"type:varchar(45)"` // ip of login or last refresh, compared to detect impossible travel
+	NotBefore        time.Time       // jwt expired at, refresh token cannot be used before this, also used when make jwt token
+	ExpireAt         time.Time       // refresh token expired at, after can't refresh with this
+	SessionCreatedAt time.Time       // first login time of session
+	RotatedAt        *time.Time      // set when refreshed, rotated token is kept to detect reuse
+	CreatedAt        time.Time       `gorm:"autoCreateTime"` // last refresh time of session
+}
+
+type SessionAPI struct {
+	UUID          binaryuuid.UUID `json:"uuid"`
+	UserAgent     string          `json:"user_agent"`
+	CreatedAt     time.Time       `json:"created_at"`
+	LastRefreshAt time.Time       `json:"last_refresh_at"`
+	Current       bool            `json:"current"`
 }
 
 func (t *Token) AfterCreate(tx *gorm.DB) error {
@@ -78,10 +115,21 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	return err
 }
 
+const (
+	TicketTypeRegister      = 0
+	TicketTypePasswordReset = 1
+	TicketTypeEmailChange   = 2
+	TicketTypeMagicLink     = 3
+)
+
 type Ticket struct {
-	Email     string          `gorm:"size:64;not null"`
-	UUID      binaryuuid.UUID `gorm:"index:unique;not null"`
-	CreatedAt time.Time       `gorm:"autoCreateTime"`
+	Email       string          `gorm:"size:64;not null"`
+	UUID        binaryuuid.UUID `gorm:"index:unique;not null"`
+	Type        uint8           `gorm:"not null;default:0"`
+	UserId      uint64          `gorm:"not null;default:0"` // email change and magic link, user who requested
+	SessionUUID binaryuuid.UUID // email change only, session kept after email changed
+	Nonce       []byte          `gorm:"size:32"` // magic link only, hashed nonce of requesting device
+	CreatedAt   time.Time       `gorm:"autoCreateTime"`
 }
 
 func (t *Ticket) BeforeCreate(tx *gorm.DB) error {
@@ -122,3 +170,124 @@ func (u *UserFollowRequest) BeforeCreate(tx *gorm.DB) error {
 	u.Code, err = binaryuuid.NewRandom()
 	return err
 }
+
+type WebauthnCredential struct {
+	Id              uint64    `gorm:"primaryKey"`
+	UserId          uint64    `gorm:"index;not null"`
+	CredentialId    []byte    `gorm:"size:255;uniqueIndex;not null"`
+	PublicKey       []byte    `gorm:"not null"`
+	AttestationType string    `gorm:"type:varchar(32)"`
+	Transport       string    `gorm:"type:varchar(64)"` // comma separated transports
+	AAGUID          []byte    `gorm:"size:16"`
+	SignCount       uint32    `gorm:"not null;default:0"`
+	BackupEligible  bool      `gorm:"not null;default:false"`
+	BackupState     bool      `gorm:"not null;default:false"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+	LastUsedAt      *time.Time
+}
+
+func (w *WebauthnCredential) BeforeCreate(tx *gorm.DB) error {
+	if w.UserId == 0 {
+		return ErrAnonymousCreate
+	}
+	return nil
+}
+
+type WebauthnCredentialAPI struct {
+	Id         uint64     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type PersonalAccessToken struct {
+	Id         uint64     `gorm:"primaryKey"`
+	UserId     uint64     `gorm:"index;not null"`
+	Name       string     `gorm:"type:varchar(64);not null"`
+	Hashed     []byte     `gorm:"size:32;uniqueIndex;not null"` // sha256 of token
+	Scopes     string     `gorm:"type:varchar(255);not null"`   // space separated scopes
+	CreatedAt  time.Time  `gorm:"autoCreateTime"`
+	ExpiredAt  *time.Time // nil is never expired
+	LastUsedAt *time.Time
+}
+
+func (p *PersonalAccessToken) BeforeCreate(tx *gorm.DB) error {
+	if p.UserId == 0 {
+		return ErrAnonymousCreate
+	}
+	return nil
+}
+
+type PersonalAccessTokenAPI struct {
+	Id         uint64     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     string     `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiredAt  *time.Time `json:"expired_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+var accountTypeNames = map[int]string{
+	AccountTypeOrigin: "origin",
+	AccountTypeGithub: "github",
+	AccountTypeKakao:  "kakao",
+}
+
+// register account type of configured provider, called before serving
+func RegisterAccountType(accountType int, name string) error {
+	if _, ok := accountTypeNames[accountType]; ok {
+		return ErrAccountTypeConflict
+	}
+	if _, ok := AccountTypeByName(name); ok {
+		return ErrAccountTypeConflict
+	}
+	accountTypeNames[accountType] = name
+	return nil
+}
+
+func AccountTypeName(accountType int) string {
+	return accountTypeNames[accountType]
+}
+
+func AccountTypeByName(name string) (int, bool) {
+	for accountType, n := range accountTypeNames {
+		if n == name {
+			return accountType, true
+		}
+	}
+	return 0, false
+}
+
+// social login identity, password login is OriginUser
+type Identity struct {
+	Id          uint64    `gorm:"primaryKey"`
+	UserId      uint64    `gorm:"index;uniqueIndex:user_account_type_idx;not null"`
+	AccountType int       `gorm:"uniqueIndex:account_type_subject_idx;uniqueIndex:user_account_type_idx;not null"`
+	Subject     string    `gorm:"type:varchar(255);uniqueIndex:account_type_subject_idx;not null"` // user id of provider
+	Email       string    `gorm:"size:64"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+}
+
+func (i *Identity) BeforeCreate(tx *gorm.DB) error {
+	if i.UserId == 0 {
+		return ErrAnonymousCreate
+	}
+	return nil
+}
+
+type IdentityAPI struct {
+	AccountType string    `json:"account_type"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// profile of user self, fields are stable for clients
+type UserProfileAPI struct {
+	Username    string    `json:"username"`
+	Email       string    `json:"email"`
+	AccountType string    `json:"account_type"`
+	Role        string    `json:"role"`
+	IsPrivate   bool      `json:"is_private"`
+	Followers   int64     `json:"followers"`
+	Followings  int64     `json:"followings"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -1,25 +1,35 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	adminAPI "github.com/capdale/was/api/admin"
 	articleAPI "github.com/capdale/was/api/article"
 	authapi "github.com/capdale/was/api/auth"
+	deviceAPI "github.com/capdale/was/api/auth/device"
 	githubAuth "github.com/capdale/was/api/auth/github"
+	identityAPI "github.com/capdale/was/api/auth/identity"
 	kakaoAuth "github.com/capdale/was/api/auth/kakao"
+	oidcAuth "github.com/capdale/was/api/auth/oidc"
 	originAPI "github.com/capdale/was/api/auth/origin"
+	webauthnAuth "github.com/capdale/was/api/auth/webauthn"
 	collect "github.com/capdale/was/api/collection"
+	oauthAPI "github.com/capdale/was/api/oauth"
 	reportAPI "github.com/capdale/was/api/report"
 	socialAPI "github.com/capdale/was/api/social"
 	userAPI "github.com/capdale/was/api/user"
 	"github.com/capdale/was/auth"
+	"github.com/capdale/was/auth/scope"
 	"github.com/capdale/was/config"
 	"github.com/capdale/was/database"
 	"github.com/capdale/was/email"
 	"github.com/capdale/was/email/ses"
 	"github.com/capdale/was/logger"
+	"github.com/capdale/was/model"
 	"github.com/capdale/was/storage"
 	localstorage "github.com/capdale/was/storage/local"
 	"github.com/capdale/was/storage/s3"
@@ -27,6 +37,8 @@ import (
 	"github.com/gin-contrib/cors"
 	ginzap "github.com/gin-contrib/zap"
 	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.uber.org/zap"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/kakao"
@@ -61,6 +73,19 @@ func SetupRouter(config *config.Config) (r *gin.Engine, err error) {
 		return
 	}
 
+	if config.Service.BootstrapAdmin != "" {
+		promoted, err := d.BootstrapAdmin(config.Service.BootstrapAdmin)
+		if errors.Is(err, database.ErrNoUserExist) {
+			// fresh deployment, user is promoted on restart after sign up
+			logger.Logger.Warn("bootstrap admin not registered yet", zap.String("username", config.Service.BootstrapAdmin))
+		} else if err != nil {
+			return nil, err
+		}
+		if promoted {
+			logger.Logger.Info("bootstrap admin", zap.String("username", config.Service.BootstrapAdmin))
+		}
+	}
+
 	store, err := store.New(&config.Redis)
 	if err != nil {
 		return
@@ -76,8 +101,6 @@ func SetupRouter(config *config.Config) (r *gin.Engine, err error) {
 		return
 	}
 
-	auth := auth.New(d, store)
-
 	var emailService email.EmailService
 	if config.Email.Mock != nil {
 		emailService = email.NewEmailMock(config.Email.Mock)
@@ -89,6 +112,17 @@ func SetupRouter(config *config.Config) (r *gin.Engine, err error) {
 		return
 	}
 
+	auth, err := auth.New(d, store, &config.Key, config.Service.Cookie, config.Service.GeoIP, emailService)
+	if err != nil {
+		return
+	}
+	if config.Service.Cookie == nil {
+		logger.Logger.Warn("service.cookie not set, oauth consent and device approval pages cannot be used")
+	}
+
+	authAPI := authapi.New(d, auth)
+	r.GET("/.well-known/jwks.json", authAPI.JWKSHandler)
+
 	r.GET("/", func(ctx *gin.Context) {
 		logger.Logger.InfoWithCTX(ctx, "log check")
 		ctx.JSON(http.StatusOK, gin.H{
@@ -101,38 +135,110 @@ func SetupRouter(config *config.Config) (r *gin.Engine, err error) {
 	collectRouter := r.Group("/collection")
 	{
 		collectRouter.GET("/list/:username", collectAPI.GetUserCollectections)
-		collectRouter.POST("/", auth.AuthorizeRequiredMiddleware(), collectAPI.CreateCollectionHandler)
-		collectRouter.GET("/:uuid", auth.AuthorizeOptionalMiddleware(), collectAPI.GetCollectionHandler)
-		collectRouter.DELETE("/:uuid", auth.AuthorizeRequiredMiddleware(), collectAPI.DeleteCollectionHandler)
-		collectRouter.GET("/image/:uuid", auth.AuthorizeOptionalMiddleware(), collectAPI.GetCollectionImageHandler)
+		collectRouter.POST("/", auth.AuthorizeRequiredMiddleware(scope.CollectionWrite), collectAPI.CreateCollectionHandler)
+		collectRouter.GET("/:uuid", auth.AuthorizeOptionalMiddleware(scope.CollectionRead), collectAPI.GetCollectionHandler)
+		collectRouter.DELETE("/:uuid", auth.AuthorizeRequiredMiddleware(scope.CollectionWrite), collectAPI.DeleteCollectionHandler)
+		collectRouter.GET("/image/:uuid", auth.AuthorizeOptionalMiddleware(scope.CollectionRead), collectAPI.GetCollectionImageHandler)
 	}
 
-	authAPI := authapi.New(d, auth)
 	createVerifyLink := func(identifier string) string {
 		return fmt.Sprintf("https://%s/auth/register/%s", config.Service.Address, identifier)
 	}
-	originAPI := originAPI.New(d, auth, emailService, createVerifyLink)
+	createResetLink := func(identifier string) string {
+		return fmt.Sprintf("https://%s/auth/password-reset/%s", config.Service.Address, identifier)
+	}
+	createEmailChangeLink := func(identifier string) string {
+		return fmt.Sprintf("https://%s/auth/email-change/%s", config.Service.Address, identifier)
+	}
+	createMagicLink := func(identifier string) string {
+		return fmt.Sprintf("https://%s/auth/magic-link/%s", config.Service.Address, identifier)
+	}
+	oauthAPI := oauthAPI.New(d, auth, store)
+	oauthRouter := r.Group("/oauth")
+	{
+		oauthRouter.GET("/authorize", oauthAPI.AuthorizeView)
+		oauthRouter.POST("/authorize", auth.AuthorizeRequiredMiddleware(), oauthAPI.AuthorizeHandler)
+		oauthRouter.POST("/token", oauthAPI.TokenHandler)
+		clientRouter := oauthRouter.Group("/clients", auth.AuthorizeRequiredMiddleware())
+		{
+			clientRouter.POST("/", oauthAPI.CreateClientHandler)
+			clientRouter.GET("/", oauthAPI.GetClientsHandler)
+			clientRouter.DELETE("/:client_id", oauthAPI.DeleteClientHandler)
+		}
+	}
+
+	originAPI := originAPI.New(d, auth, store, emailService, createVerifyLink, createResetLink, createEmailChangeLink, createMagicLink)
 	authRouter := r.Group("/auth")
 	{
-		authRouter.POST("/blacklist", auth.AuthorizeRequiredMiddleware(), authAPI.SetBlacklistHandler)
+		authRouter.POST("/logout", authAPI.LogoutHandler)
+		authRouter.POST("/logout/all", auth.AuthorizeRequiredMiddleware(), authAPI.LogoutAllHandler)
 		authRouter.POST("/refresh", authAPI.RefreshTokenHandler)
-		githubAuth := githubAuth.New(d, auth, store, &oauth2.Config{
+		tokenRouter := authRouter.Group("/tokens", auth.AuthorizeRequiredMiddleware())
+		{
+			tokenRouter.POST("/", authAPI.CreatePersonalAccessTokenHandler)
+			tokenRouter.GET("/", authAPI.GetPersonalAccessTokensHandler)
+			tokenRouter.DELETE("/:id", authAPI.DeletePersonalAccessTokenHandler)
+		}
+		sessionRouter := authRouter.Group("/sessions", auth.AuthorizeRequiredMiddleware())
+		{
+			sessionRouter.GET("/", authAPI.GetSessionsHandler)
+			sessionRouter.DELETE("/", authAPI.RevokeOtherSessionsHandler)
+			sessionRouter.DELETE("/:uuid", authAPI.RevokeSessionHandler)
+		}
+		appRouter := authRouter.Group("/apps", auth.AuthorizeRequiredMiddleware())
+		{
+			appRouter.GET("/", oauthAPI.GetGrantsHandler)
+			appRouter.DELETE("/:client_id", oauthAPI.DeleteGrantHandler)
+		}
+		identityAPI := identityAPI.New(d, auth, store, config.Oauth.Apps)
+		identityRouter := authRouter.Group("/identities", auth.AuthorizeRequiredMiddleware())
+		{
+			identityRouter.GET("/", identityAPI.GetIdentitiesHandler)
+			identityRouter.POST("/link", identityAPI.LinkIdentityHandler)
+			identityRouter.POST("/origin", originAPI.CreatePasswordHandler)
+			identityRouter.DELETE("/origin", originAPI.DeletePasswordHandler)
+			identityRouter.DELETE("/:provider", identityAPI.DeleteIdentityHandler)
+		}
+		authRouter.POST("/code", identityAPI.ExchangeCodeHandler)
+		authRouter.POST("/social/register", identityAPI.RegisterHandler)
+		githubAuth := authapi.NewProviderAuth(store, identityAPI, githubAuth.New(&oauth2.Config{
 			ClientID:     config.Oauth.Github.Id,
 			ClientSecret: config.Oauth.Github.Secret,
 			RedirectURL:  config.Oauth.Github.Redirect,
 			Scopes:       []string{"user:email"},
 			Endpoint:     github.Endpoint,
-		})
-		kakaoAuth := kakaoAuth.New(d, auth, store, &oauth2.Config{
+		}))
+		kakaoAuth := authapi.NewProviderAuth(store, identityAPI, kakaoAuth.New(&oauth2.Config{
 			ClientID:     config.Oauth.Kakao.Id,
 			ClientSecret: config.Oauth.Kakao.Secret,
 			RedirectURL:  config.Oauth.Kakao.Redirect,
 			Scopes:       []string{"account_email"},
 			Endpoint:     kakao.Endpoint,
-		})
+		}))
 		authRouter.POST("/regist-email", originAPI.CreateEmailTicketHandler)
 		authRouter.POST("/regist", originAPI.RegisterTicketHandler)
+		authRouter.POST("/password-reset-email", originAPI.CreatePasswordResetTicketHandler)
+		authRouter.POST("/password-reset", originAPI.ResetPasswordHandler)
+		authRouter.POST("/password", auth.AuthorizeRequiredMiddleware(), originAPI.ChangePasswordHandler)
+		authRouter.POST("/email", auth.AuthorizeRequiredMiddleware(), originAPI.CreateEmailChangeTicketHandler)
+		authRouter.POST("/email-change", originAPI.ChangeEmailHandler)
 		authRouter.POST("/login", originAPI.LoginHandler)
+		authRouter.POST("/login/mfa", originAPI.LoginMfaHandler)
+		authRouter.POST("/magic-link", originAPI.CreateMagicLinkHandler)
+		authRouter.POST("/magic-link/login", originAPI.MagicLinkLoginHandler)
+		deviceAPI := deviceAPI.New(auth, store, config.Oauth.Devices, fmt.Sprintf("https://%s/auth/device", config.Service.Address))
+		deviceRouter := authRouter.Group("/device")
+		{
+			deviceRouter.POST("/code", deviceAPI.DeviceCodeHandler)
+			deviceRouter.POST("/token", deviceAPI.DeviceTokenHandler)
+			deviceRouter.POST("/approve", auth.AuthorizeRequiredMiddleware(), deviceAPI.ApproveDeviceHandler)
+		}
+		totpRouter := authRouter.Group("/2fa/totp", auth.AuthorizeRequiredMiddleware())
+		{
+			totpRouter.POST("/", originAPI.StartTOTPHandler)
+			totpRouter.POST("/verify", originAPI.EnableTOTPHandler)
+			totpRouter.DELETE("/", originAPI.DisableTOTPHandler)
+		}
 		githubAuthRouter := authRouter.Group("/github")
 		{
 			githubAuthRouter.GET("/login", githubAuth.LoginHandler)
@@ -144,19 +250,66 @@ func SetupRouter(config *config.Config) (r *gin.Engine, err error) {
 			kakaoAuthRouter.POST("/login/token", kakaoAuth.LoginWithAccessTokenHandler)
 			kakaoAuthRouter.GET("/callback", kakaoAuth.CallbackHandler)
 		}
+		for _, oidcConfig := range config.Oauth.Oidc {
+			if err := model.RegisterAccountType(oidcConfig.AccountType, oidcConfig.Name); err != nil {
+				return nil, fmt.Errorf("oidc provider %s: %w", oidcConfig.Name, err)
+			}
+			provider, err := oidcAuth.New(context.Background(), oidcConfig)
+			if err != nil {
+				return nil, err
+			}
+			oidcAuth := authapi.NewProviderAuth(store, identityAPI, provider)
+			oidcAuthRouter := authRouter.Group("/" + oidcConfig.Name)
+			{
+				oidcAuthRouter.GET("/login", oidcAuth.LoginHandler)
+				oidcAuthRouter.GET("/callback", oidcAuth.CallbackHandler)
+			}
+		}
+		if config.Webauthn != nil {
+			webAuthn, err := webauthn.New(&webauthn.Config{
+				RPID:          config.Webauthn.RPID,
+				RPDisplayName: config.Webauthn.RPDisplayName,
+				RPOrigins:     config.Webauthn.RPOrigins,
+			})
+			if err != nil {
+				return nil, err
+			}
+			webauthnAuth := webauthnAuth.New(d, auth, store, webAuthn)
+			webauthnAuthRouter := authRouter.Group("/webauthn")
+			{
+				webauthnAuthRouter.POST("/register/begin", auth.AuthorizeRequiredMiddleware(), webauthnAuth.BeginRegistrationHandler)
+				webauthnAuthRouter.POST("/register/finish", auth.AuthorizeRequiredMiddleware(), webauthnAuth.FinishRegistrationHandler)
+				webauthnAuthRouter.POST("/login/begin", webauthnAuth.BeginLoginHandler)
+				webauthnAuthRouter.POST("/login/finish", webauthnAuth.FinishLoginHandler)
+				webauthnAuthRouter.GET("/credentials", auth.AuthorizeRequiredMiddleware(), webauthnAuth.GetCredentialsHandler)
+				webauthnAuthRouter.DELETE("/credentials/:id", auth.AuthorizeRequiredMiddleware(), webauthnAuth.DeleteCredentialHandler)
+			}
+		}
+		authRouter.GET("/me", auth.AuthorizeRequiredMiddleware(scope.UserRead), authAPI.WhoAmIHandler)
+		authRouter.PATCH("/me", auth.AuthorizeRequiredMiddleware(scope.UserWrite), authAPI.UpdateMeHandler)
 		authRouter.DELETE("/", auth.AuthorizeRequiredMiddleware(), authAPI.DeleteUserAccountHandler)
 
 		authRouter.GET("/register/:ticket", originAPI.RegisterTicketView)
+		authRouter.GET("/password-reset/:ticket", originAPI.PasswordResetTicketView)
+		authRouter.GET("/email-change/:ticket", originAPI.EmailChangeTicketView)
+		authRouter.GET("/magic-link/:ticket", originAPI.MagicLinkTicketView)
+		authRouter.GET("/device", deviceAPI.DeviceView)
+	}
+
+	adminAPI := adminAPI.New(auth)
+	adminRouter := r.Group("/admin", auth.AuthorizeRequiredMiddleware(), auth.RequireRole(model.RoleAdmin))
+	{
+		adminRouter.PUT("/users/:username/role", adminAPI.SetUserRoleHandler)
 	}
 
 	userAPI := userAPI.New(d)
 	userRouter := r.Group("/user")
 	{
-		userRouter.POST("/visibility/:type", auth.AuthorizeRequiredMiddleware(), userAPI.ChangeVisibilityHandler)
+		userRouter.POST("/visibility/:type", auth.AuthorizeRequiredMiddleware(scope.UserWrite), userAPI.ChangeVisibilityHandler)
 	}
 
 	reportAPI := reportAPI.New(d)
-	reportRouter := r.Group("/report", auth.AuthorizeOptionalMiddleware()) // anonymous can report too
+	reportRouter := r.Group("/report", auth.AuthorizeOptionalMiddleware(scope.ReportWrite)) // anonymous can report too
 	{
 		reportRouter.POST("/user", reportAPI.PostUserReportHandler)
 		reportRouter.POST("/article", reportAPI.PostReportArticleHandler)
@@ -168,38 +321,38 @@ func SetupRouter(config *config.Config) (r *gin.Engine, err error) {
 	articleAPI := articleAPI.New(d, storage)
 	articleRouter := r.Group("/article")
 	{
-		articleRouter.POST("/", auth.AuthorizeRequiredMiddleware(), articleAPI.CreateArticleHandler)
+		articleRouter.POST("/", auth.AuthorizeRequiredMiddleware(scope.ArticleWrite), articleAPI.CreateArticleHandler)
 		articleRouter.GET("/get-links", articleAPI.GetPublicArticlesHandler)
 		articleRouter.GET("/get-links/:targetname", articleAPI.GetUserArticleLinksHandler)
-		articleRouter.GET("/:link", auth.AuthorizeOptionalMiddleware(), articleAPI.GetArticleHandler)
-		articleRouter.DELETE("/:link", auth.AuthorizeRequiredMiddleware(), articleAPI.DeleteArticleHandler)
-		articleRouter.GET("/image/:uuid", auth.AuthorizeOptionalMiddleware(), articleAPI.GetArticleImageHandler)
+		articleRouter.GET("/:link", auth.AuthorizeOptionalMiddleware(scope.ArticleRead), articleAPI.GetArticleHandler)
+		articleRouter.DELETE("/:link", auth.AuthorizeRequiredMiddleware(scope.ArticleWrite), articleAPI.DeleteArticleHandler)
+		articleRouter.GET("/image/:uuid", auth.AuthorizeOptionalMiddleware(scope.ArticleRead), articleAPI.GetArticleImageHandler)
 
-		articleRouter.GET("/:link/comment", auth.AuthorizeOptionalMiddleware(), articleAPI.GetCommentsHandler)
-		articleRouter.POST("/:link/comment", auth.AuthorizeRequiredMiddleware(), articleAPI.PostCommentHandler)
+		articleRouter.GET("/:link/comment", auth.AuthorizeOptionalMiddleware(scope.ArticleRead), articleAPI.GetCommentsHandler)
+		articleRouter.POST("/:link/comment", auth.AuthorizeRequiredMiddleware(scope.ArticleWrite), articleAPI.PostCommentHandler)
 
-		articleRouter.POST("/:link/heart", auth.AuthorizeRequiredMiddleware(), articleAPI.HeartHandler)
-		articleRouter.GET("/:link/heart", auth.AuthorizeRequiredMiddleware(), articleAPI.GetHeartStateHandler)
-		articleRouter.GET("/:link/heart/count", auth.AuthorizeOptionalMiddleware(), articleAPI.GetHeartCountHandler)
+		articleRouter.POST("/:link/heart", auth.AuthorizeRequiredMiddleware(scope.ArticleWrite), articleAPI.HeartHandler)
+		articleRouter.GET("/:link/heart", auth.AuthorizeRequiredMiddleware(scope.ArticleRead), articleAPI.GetHeartStateHandler)
+		articleRouter.GET("/:link/heart/count", auth.AuthorizeOptionalMiddleware(scope.ArticleRead), articleAPI.GetHeartCountHandler)
 	}
 
 	socialAPI := socialAPI.New(d)
 	socialRouter := r.Group("/social")
 	{
 		// TODO: auth for secret account
-		socialRouter.GET("/follower/:targetname", auth.AuthorizeOptionalMiddleware(), socialAPI.GetFollowersHandler)
-		socialRouter.GET("/following/:targetname", auth.AuthorizeOptionalMiddleware(), socialAPI.GetFollowingsHandler)
-
-		socialRouter.GET("/is-following/:targetname", auth.AuthorizeRequiredMiddleware(), socialAPI.GetFollowingRelationHandler)
-		socialRouter.GET("/is-follower/:targetname", auth.AuthorizeRequiredMiddleware(), socialAPI.GetFollowerRelationHandler)
-		socialRouter.GET("/relation/:targetname", auth.AuthorizeRequiredMiddleware(), socialAPI.GetRelationHandler)
-		socialRouter.DELETE("/follower/:targetname", auth.AuthorizeRequiredMiddleware(), socialAPI.DeleteFollowerHandler)
-		socialRouter.DELETE("/following/:targetname", auth.AuthorizeRequiredMiddleware(), socialAPI.DeleteFollowingHandler)
+		socialRouter.GET("/follower/:targetname", auth.AuthorizeOptionalMiddleware(scope.SocialRead), socialAPI.GetFollowersHandler)
+		socialRouter.GET("/following/:targetname", auth.AuthorizeOptionalMiddleware(scope.SocialRead), socialAPI.GetFollowingsHandler)
+
+		socialRouter.GET("/is-following/:targetname", auth.AuthorizeRequiredMiddleware(scope.SocialRead), socialAPI.GetFollowingRelationHandler)
+		socialRouter.GET("/is-follower/:targetname", auth.AuthorizeRequiredMiddleware(scope.SocialRead), socialAPI.GetFollowerRelationHandler)
+		socialRouter.GET("/relation/:targetname", auth.AuthorizeRequiredMiddleware(scope.SocialRead), socialAPI.GetRelationHandler)
+		socialRouter.DELETE("/follower/:targetname", auth.AuthorizeRequiredMiddleware(scope.SocialWrite), socialAPI.DeleteFollowerHandler)
+		socialRouter.DELETE("/following/:targetname", auth.AuthorizeRequiredMiddleware(scope.SocialWrite), socialAPI.DeleteFollowingHandler)
 		// request follow
-		socialRouter.POST("/follow/:targetname", auth.AuthorizeRequiredMiddleware(), socialAPI.RequestFollowHandler)
-		socialRouter.GET("/requests", auth.AuthorizeRequiredMiddleware(), socialAPI.GetFollowRequestsHandler)
-		socialRouter.POST("/follow/accept/:code", auth.AuthorizeRequiredMiddleware(), socialAPI.AcceptRequestFollowHandler)
-		socialRouter.POST("/follow/reject/:code", auth.AuthorizeRequiredMiddleware(), socialAPI.RejectRequestFollowHandler)
+		socialRouter.POST("/follow/:targetname", auth.AuthorizeRequiredMiddleware(scope.SocialWrite), socialAPI.RequestFollowHandler)
+		socialRouter.GET("/requests", auth.AuthorizeRequiredMiddleware(scope.SocialRead), socialAPI.GetFollowRequestsHandler)
+		socialRouter.POST("/follow/accept/:code", auth.AuthorizeRequiredMiddleware(scope.SocialWrite), socialAPI.AcceptRequestFollowHandler)
+		socialRouter.POST("/follow/reject/:code", auth.AuthorizeRequiredMiddleware(scope.SocialWrite), socialAPI.RejectRequestFollowHandler)
 	}
 
 	return r, nil
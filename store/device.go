@@ -0,0 +1,109 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func (s *Store) deviceCodeKey(deviceCode string) (string, error) {
+	hashedCode, err := s.decodeState(deviceCode)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("device_%s", *hashedCode), nil
+}
+
+func (s *Store) deviceUserCodeKey(userCode string) (string, error) {
+	hashedCode, err := s.decodeState(userCode)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("device_user_%s", *hashedCode), nil
+}
+
+// device authorization, device code points user code and user code holds authorization data,
+// false if user code is already pending
+func (s *Store) SetDeviceAuthorization(deviceCode string, userCode string, data []byte, expired time.Duration) (bool, error) {
+	deviceKey, err := s.deviceCodeKey(deviceCode)
+	if err != nil {
+		return false, err
+	}
+	userKey, err := s.deviceUserCodeKey(userCode)
+	if err != nil {
+		return false, err
+	}
+	ok, err := s.Store.SetNX(ctx, userKey, data, expired).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+	return true, s.Store.Set(ctx, deviceKey, userCode, expired).Err()
+}
+
+func (s *Store) GetDeviceAuthorization(userCode string) ([]byte, error) {
+	userKey, err := s.deviceUserCodeKey(userCode)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.Get(ctx, userKey).Bytes()
+}
+
+var updateDeviceAuthorizationScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+return 1
+`)
+
+// update approved or denied authorization only if it is not changed from previous, expiration is kept,
+// false if other request decided first or authorization is expired
+func (s *Store) UpdateDeviceAuthorization(userCode string, previous []byte, data []byte) (bool, error) {
+	userKey, err := s.deviceUserCodeKey(userCode)
+	if err != nil {
+		return false, err
+	}
+	return updateDeviceAuthorizationScript.Run(ctx, s.Store, []string{userKey}, previous, data).Bool()
+}
+
+func (s *Store) GetDeviceUserCode(deviceCode string) (string, error) {
+	deviceKey, err := s.deviceCodeKey(deviceCode)
+	if err != nil {
+		return "", err
+	}
+	return s.Store.Get(ctx, deviceKey).Result()
+}
+
+// device code is single use, only one poll can pop it
+func (s *Store) PopDeviceAuthorization(deviceCode string, userCode string) error {
+	deviceKey, err := s.deviceCodeKey(deviceCode)
+	if err != nil {
+		return err
+	}
+	userKey, err := s.deviceUserCodeKey(userCode)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.Store.Del(ctx, deviceKey).Result()
+	if err != nil {
+		return err
+	}
+	if deleted < 1 {
+		return ErrInvalidPopKey
+	}
+	return s.Store.Del(ctx, userKey).Err()
+}
+
+// true if device polls again within interval
+func (s *Store) IsDevicePollTooFast(deviceCode string, interval time.Duration) (bool, error) {
+	hashedCode, err := s.decodeState(deviceCode)
+	if err != nil {
+		return false, err
+	}
+	ok, err := s.Store.SetNX(ctx, fmt.Sprintf("device_poll_%s", *hashedCode), 1, interval).Result()
+	if err != nil {
+		return false, err
+	}
+	return !ok, nil
+}
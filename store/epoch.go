@@ -0,0 +1,27 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func tokenEpochKey(claimer string) string {
+	return fmt.Sprintf("epoch_%s", claimer)
+}
+
+// cached token epoch of user, ok is false when cache missed
+func (s *Store) GetTokenEpoch(claimer string) (epoch uint64, ok bool, err error) {
+	epoch, err = s.Store.Get(ctx, tokenEpochKey(claimer)).Uint64()
+	if err == redis.Nil {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+	return epoch, true, nil
+}
+
+func (s *Store) SetTokenEpoch(claimer string, epoch uint64, expiration time.Duration) error {
+	return s.Store.Set(ctx, tokenEpochKey(claimer), epoch, expiration).Err()
+}
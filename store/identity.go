@@ -0,0 +1,82 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// identity waiting to be linked by logged in user, single use
+func (s *Store) SetLinkToken(token string, data []byte, expired time.Duration) error {
+	hashedToken, err := s.decodeState(token)
+	if err != nil {
+		return err
+	}
+	return s.Store.Set(ctx, fmt.Sprintf("link_%s", *hashedToken), data, expired).Err()
+}
+
+func (s *Store) PopLinkToken(token string) ([]byte, error) {
+	hashedToken, err := s.decodeState(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.GetDel(ctx, fmt.Sprintf("link_%s", *hashedToken)).Bytes()
+}
+
+// one-time code of app login, exchanged to token by app
+func (s *Store) SetLoginCode(code string, data []byte, expired time.Duration) error {
+	hashedCode, err := s.decodeState(code)
+	if err != nil {
+		return err
+	}
+	return s.Store.Set(ctx, fmt.Sprintf("code_%s", *hashedCode), data, expired).Err()
+}
+
+func (s *Store) PopLoginCode(code string) ([]byte, error) {
+	hashedCode, err := s.decodeState(code)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.GetDel(ctx, fmt.Sprintf("code_%s", *hashedCode)).Bytes()
+}
+
+// identity of first social login waiting for username, deleted when user is created
+func (s *Store) SetRegistrationToken(token string, data []byte, expired time.Duration) error {
+	hashedToken, err := s.decodeState(token)
+	if err != nil {
+		return err
+	}
+	return s.Store.Set(ctx, fmt.Sprintf("register_%s", *hashedToken), data, expired).Err()
+}
+
+func (s *Store) GetRegistrationToken(token string) ([]byte, error) {
+	hashedToken, err := s.decodeState(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.Get(ctx, fmt.Sprintf("register_%s", *hashedToken)).Bytes()
+}
+
+func (s *Store) DeleteRegistrationToken(token string) error {
+	hashedToken, err := s.decodeState(token)
+	if err != nil {
+		return err
+	}
+	return s.Store.Del(ctx, fmt.Sprintf("register_%s", *hashedToken)).Err()
+}
+
+// authorization code of oauth client, exchanged to token by client
+func (s *Store) SetAuthorizationCode(code string, data []byte, expired time.Duration) error {
+	hashedCode, err := s.decodeState(code)
+	if err != nil {
+		return err
+	}
+	return s.Store.Set(ctx, fmt.Sprintf("oauth_code_%s", *hashedCode), data, expired).Err()
+}
+
+func (s *Store) PopAuthorizationCode(code string) ([]byte, error) {
+	hashedCode, err := s.decodeState(code)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.GetDel(ctx, fmt.Sprintf("oauth_code_%s", *hashedCode)).Bytes()
+}
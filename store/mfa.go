@@ -0,0 +1,77 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func (s *Store) mfaChallengeKey(challenge string) (string, error) {
+	hashedChallenge, err := s.decodeState(challenge)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("mfa_%s", *hashedChallenge), nil
+}
+
+// mfa pending challenge, issued when password verified but second factor required
+func (s *Store) SetMfaChallenge(challenge string, claimer string, expired time.Duration) error {
+	key, err := s.mfaChallengeKey(challenge)
+	if err != nil {
+		return err
+	}
+	_, err = s.Store.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, "claimer", claimer, "tries", 0)
+		pipe.Expire(ctx, key, expired)
+		return nil
+	})
+	return err
+}
+
+func (s *Store) GetMfaChallenge(challenge string) (string, error) {
+	key, err := s.mfaChallengeKey(challenge)
+	if err != nil {
+		return "", err
+	}
+	claimer, err := s.Store.HGet(ctx, key, "claimer").Result()
+	if err != nil {
+		return "", err
+	}
+	return claimer, nil
+}
+
+var failMfaChallengeScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+local tries = redis.call("HINCRBY", KEYS[1], "tries", 1)
+if tries >= tonumber(ARGV[1]) then
+	redis.call("DEL", KEYS[1])
+end
+return tries
+`)
+
+// count failed try, challenge removed when tries reach maxTries
+func (s *Store) FailMfaChallenge(challenge string, maxTries int64) error {
+	key, err := s.mfaChallengeKey(challenge)
+	if err != nil {
+		return err
+	}
+	return failMfaChallengeScript.Run(ctx, s.Store, []string{key}, maxTries).Err()
+}
+
+func (s *Store) PopMfaChallenge(challenge string) error {
+	key, err := s.mfaChallengeKey(challenge)
+	if err != nil {
+		return err
+	}
+	deleted, err := s.Store.Del(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if deleted < 1 {
+		return ErrInvalidPopKey
+	}
+	return nil
+}
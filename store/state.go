@@ -24,28 +24,21 @@ func (s *Store) decodeState(state string) (*string, error) {
 
 var ErrInvalidPopKey = errors.New("try to pop invalid key")
 
-func (s *Store) SetState(state string, expired time.Duration) error {
+// login state of oauth, data is pkce verifier and app redirect
+func (s *Store) SetState(state string, data []byte, expired time.Duration) error {
 	hashedState, err := s.decodeState(state)
 	if err != nil {
 		return err
 	}
 
-	return s.Store.Set(ctx, fmt.Sprintf("state_%s", *hashedState), "s", expired).Err()
+	return s.Store.Set(ctx, fmt.Sprintf("state_%s", *hashedState), data, expired).Err()
 }
 
-func (s *Store) PopState(state string) error {
+func (s *Store) PopState(state string) ([]byte, error) {
 	hashedState, err := s.decodeState(state)
 	if err != nil {
-		return err
-	}
-
-	value, err := s.Store.GetDel(ctx, fmt.Sprintf("state_%s", *hashedState)).Result()
-	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if value != "s" {
-		return ErrInvalidPopKey
-	}
-	return nil
+	return s.Store.GetDel(ctx, fmt.Sprintf("state_%s", *hashedState)).Bytes()
 }
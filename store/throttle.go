@@ -0,0 +1,70 @@
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func (s *Store) throttleKeys(key string) (attemptKey string, lockKey string, err error) {
+	hashedKey, err := s.decodeState(key)
+	if err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("attempt_%s", *hashedKey), fmt.Sprintf("lock_%s", *hashedKey), nil
+}
+
+// remaining lockout of key, 0 if not locked
+func (s *Store) GetLockout(key string) (time.Duration, error) {
+	_, lockKey, err := s.throttleKeys(key)
+	if err != nil {
+		return 0, err
+	}
+	ttl, err := s.Store.PTTL(ctx, lockKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// lockout is doubled for each attempt after threshold, up to max lockout
+var failAttemptScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+local threshold = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+if count < threshold then
+	redis.call("PEXPIRE", KEYS[1], window)
+	return {count, 0}
+end
+local lockout = math.min(tonumber(ARGV[3]) * 2 ^ (count - threshold), tonumber(ARGV[4]))
+lockout = math.floor(lockout)
+redis.call("SET", KEYS[2], 1, "PX", lockout)
+redis.call("PEXPIRE", KEYS[1], math.max(window, lockout * 2))
+return {count, lockout}
+`)
+
+// count attempt of key in window, return attempt count and lockout set by this attempt
+func (s *Store) FailAttempt(key string, threshold int64, window time.Duration, lockout time.Duration, maxLockout time.Duration) (int64, time.Duration, error) {
+	attemptKey, lockKey, err := s.throttleKeys(key)
+	if err != nil {
+		return 0, 0, err
+	}
+	result, err := failAttemptScript.Run(ctx, s.Store, []string{attemptKey, lockKey},
+		threshold, window.Milliseconds(), lockout.Milliseconds(), maxLockout.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	return result[0], time.Duration(result[1]) * time.Millisecond, nil
+}
+
+func (s *Store) ResetAttempts(key string) error {
+	attemptKey, _, err := s.throttleKeys(key)
+	if err != nil {
+		return err
+	}
+	return s.Store.Del(ctx, attemptKey).Err()
+}
@@ -0,0 +1,23 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// webauthn ceremony session data, single use
+func (s *Store) SetWebauthnSession(session string, data []byte, expired time.Duration) error {
+	hashedSession, err := s.decodeState(session)
+	if err != nil {
+		return err
+	}
+	return s.Store.Set(ctx, fmt.Sprintf("webauthn_%s", *hashedSession), data, expired).Err()
+}
+
+func (s *Store) PopWebauthnSession(session string) ([]byte, error) {
+	hashedSession, err := s.decodeState(session)
+	if err != nil {
+		return nil, err
+	}
+	return s.Store.GetDel(ctx, fmt.Sprintf("webauthn_%s", *hashedSession)).Bytes()
+}